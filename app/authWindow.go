@@ -0,0 +1,144 @@
+package app
+
+import (
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/prorok210/TestYourServer/core"
+)
+
+var (
+	authButton     *widget.Button
+	authWindowOpen bool
+	authConfig     = &core.AuthConfig{}
+)
+
+func showAuthWindow() {
+	if authWindowOpen {
+		return
+	}
+	authWindowOpen = true
+
+	authWindow := fyne.CurrentApp().NewWindow("Authentication")
+
+	authTypes := []core.AuthType{
+		core.AUTH_NONE,
+		core.AUTH_BASIC,
+		core.AUTH_BEARER,
+		core.AUTH_OAUTH2_CLIENT_CREDENTIALS,
+		core.AUTH_OAUTH2_PASSWORD,
+	}
+	authTypeOptions := make([]string, 0, len(authTypes))
+	for _, t := range authTypes {
+		authTypeOptions = append(authTypeOptions, t.String())
+	}
+
+	usernameEntry := widget.NewEntry()
+	usernameEntry.SetPlaceHolder("Username")
+	usernameEntry.SetText(authConfig.Username)
+
+	passwordEntry := widget.NewPasswordEntry()
+	passwordEntry.SetPlaceHolder("Password")
+	passwordEntry.SetText(authConfig.Password)
+
+	tokenEntry := widget.NewPasswordEntry()
+	tokenEntry.SetPlaceHolder("Bearer token")
+	tokenEntry.SetText(authConfig.Token)
+
+	tokenURLEntry := widget.NewEntry()
+	tokenURLEntry.SetPlaceHolder("Token URL (e.g. https://auth.example.com/oauth/token)")
+	tokenURLEntry.SetText(authConfig.TokenURL)
+
+	clientIDEntry := widget.NewEntry()
+	clientIDEntry.SetPlaceHolder("Client ID")
+	clientIDEntry.SetText(authConfig.ClientID)
+
+	clientSecretEntry := widget.NewPasswordEntry()
+	clientSecretEntry.SetPlaceHolder("Client secret")
+	clientSecretEntry.SetText(authConfig.ClientSecret)
+
+	scopesEntry := widget.NewEntry()
+	scopesEntry.SetPlaceHolder("Scopes (space separated, optional)")
+	scopesEntry.SetText(strings.Join(authConfig.Scopes, " "))
+
+	cacheSelect := widget.NewSelect([]string{core.TOKEN_CACHE_GLOBAL.String(), core.TOKEN_CACHE_PER_WORKER.String()}, nil)
+	cacheSelect.SetSelected(authConfig.Cache.String())
+
+	basicBox := container.NewVBox(usernameEntry, passwordEntry)
+	bearerBox := container.NewVBox(tokenEntry)
+	oauthBox := container.NewVBox(
+		tokenURLEntry,
+		clientIDEntry,
+		clientSecretEntry,
+		scopesEntry,
+		container.NewHBox(widget.NewLabel("Token cache"), cacheSelect),
+	)
+
+	var selectedType core.AuthType
+	typeSelect := widget.NewSelect(authTypeOptions, func(s string) {
+		for _, t := range authTypes {
+			if t.String() == s {
+				selectedType = t
+			}
+		}
+
+		basicBox.Hide()
+		bearerBox.Hide()
+		oauthBox.Hide()
+
+		switch selectedType {
+		case core.AUTH_BASIC:
+			basicBox.Show()
+		case core.AUTH_BEARER:
+			bearerBox.Show()
+		case core.AUTH_OAUTH2_CLIENT_CREDENTIALS:
+			oauthBox.Show()
+		case core.AUTH_OAUTH2_PASSWORD:
+			basicBox.Show()
+			oauthBox.Show()
+		}
+	})
+	typeSelect.SetSelected(authConfig.Type.String())
+
+	okButton := widget.NewButton("OK", func() {
+		newConfig := &core.AuthConfig{
+			Type:         selectedType,
+			Username:     strings.TrimSpace(usernameEntry.Text),
+			Password:     passwordEntry.Text,
+			Token:        strings.TrimSpace(tokenEntry.Text),
+			TokenURL:     strings.TrimSpace(tokenURLEntry.Text),
+			ClientID:     strings.TrimSpace(clientIDEntry.Text),
+			ClientSecret: clientSecretEntry.Text,
+			Scopes:       strings.Fields(scopesEntry.Text),
+		}
+		if cacheSelect.Selected == core.TOKEN_CACHE_PER_WORKER.String() {
+			newConfig.Cache = core.TOKEN_CACHE_PER_WORKER
+		}
+
+		if err := core.ValidateAuthConfig(newConfig); err != nil {
+			dialog.ShowInformation("Error", err.Error(), authWindow)
+			return
+		}
+
+		authConfig = newConfig
+		authWindow.Close()
+	})
+
+	authWindow.SetOnClosed(func() {
+		authWindowOpen = false
+	})
+
+	authWindow.SetContent(container.NewVBox(
+		widget.NewLabel("Authentication type"),
+		typeSelect,
+		basicBox,
+		bearerBox,
+		oauthBox,
+		okButton,
+	))
+	authWindow.Resize(fyne.NewSize(500, 300))
+	authWindow.Show()
+}
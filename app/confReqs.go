@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -18,24 +19,44 @@ const (
 
 var (
 	protocolButton    *widget.Button
+	confWindow        fyne.Window
 	confWindowOpen    bool
 	activRequstsRows  []*RequestRow
 	activRequsts      []core.Request
 	requestsContainer *fyne.Container
+	rowExtras         = make(map[*fyne.Container]*rowExtra)
+	scenarioCheck     *widget.Check
+	scenarioMode      bool
+	activScenario     []core.ScenarioStep
 )
 
+// rowExtra keeps the parts of an imported request a row can't show.
+type rowExtra struct {
+	name   string
+	group  string
+	tags   []string
+	header http.Header
+	// Pause before the request when the rows run as a scenario
+	delay time.Duration
+}
+
 type RequestRow struct {
 	method    *widget.Select
 	url       *widget.Entry
 	body      *widget.Entry
+	extra     *rowExtra
 	delete    *widget.Button
 	container *fyne.Container
 }
 
 func createRequestRow() *fyne.Container {
+	return newRequestRow("GET", "", "")
+}
+
+func newRequestRow(method, url, body string) *fyne.Container {
 	var row *fyne.Container
-	methodSelect := widget.NewSelect([]string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"}, nil)
-	methodSelect.SetSelected("GET")
+	methodSelect := widget.NewSelect([]string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS", "HEAD"}, nil)
+	methodSelect.SetSelected(method)
 
 	urlEntry := widget.NewEntry()
 	urlEntry.SetPlaceHolder("Enter URL (e.g. http://example.com)")
@@ -56,6 +77,12 @@ func createRequestRow() *fyne.Container {
 			}
 		}
 	}
+	urlEntry.SetText(url)
+	bodyEntry.SetText(body)
+
+	editButton := widget.NewButton("✎", func() {
+		showRowLabelsDialog(row)
+	})
 
 	deleteButton := widget.NewButton("❌", func() {
 		deleteRow(row)
@@ -63,7 +90,7 @@ func createRequestRow() *fyne.Container {
 
 	split1 := container.NewHSplit(methodSelect, urlEntry)
 	split1.Offset = 0.01
-	split2 := container.NewHSplit(bodyEntry, deleteButton)
+	split2 := container.NewHSplit(bodyEntry, container.NewHBox(editButton, deleteButton))
 	split2.Offset = 0.99
 
 	row = container.NewAdaptiveGrid(1,
@@ -76,6 +103,75 @@ func createRequestRow() *fyne.Container {
 	return row
 }
 
+// rowWidgets finds the widgets of a row made by newRequestRow.
+func rowWidgets(row *fyne.Container) (methodSelect *widget.Select, urlEntry, bodyEntry *widget.Entry, deleteButton *widget.Button, ok bool) {
+	if len(row.Objects) == 0 {
+		return
+	}
+	hSplit, ok := row.Objects[0].(*container.Split)
+	if !ok {
+		return
+	}
+	split1, ok := hSplit.Leading.(*container.Split)
+	if !ok {
+		return
+	}
+	split2, ok := hSplit.Trailing.(*container.Split)
+	if !ok {
+		return
+	}
+	buttons, ok := split2.Trailing.(*fyne.Container)
+	if !ok || len(buttons.Objects) != 2 {
+		return nil, nil, nil, nil, false
+	}
+
+	if methodSelect, ok = split1.Leading.(*widget.Select); !ok {
+		return
+	}
+	if urlEntry, ok = split1.Trailing.(*widget.Entry); !ok {
+		return
+	}
+	if bodyEntry, ok = split2.Leading.(*widget.Entry); !ok {
+		return
+	}
+	deleteButton, ok = buttons.Objects[1].(*widget.Button)
+	return
+}
+
+func showRowLabelsDialog(row *fyne.Container) {
+	extra := rowExtras[row]
+
+	nameEntry := widget.NewEntry()
+	nameEntry.SetPlaceHolder("e.g. getUser")
+	tagsEntry := widget.NewEntry()
+	tagsEntry.SetPlaceHolder("e.g. read, users")
+	if extra != nil {
+		nameEntry.SetText(extra.name)
+		tagsEntry.SetText(strings.Join(extra.tags, ", "))
+	}
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Name", nameEntry),
+		widget.NewFormItem("Tags", tagsEntry),
+	}
+	items[0].HintText = "Requests with the same name share one report"
+	items[1].HintText = "Comma separated, the report adds up requests by tag"
+
+	labelsDialog := dialog.NewForm("Name and tags", "Save", "Cancel", items, func(ok bool) {
+		if !ok {
+			return
+		}
+		if extra == nil {
+			extra = &rowExtra{}
+			rowExtras[row] = extra
+		}
+		extra.name = strings.TrimSpace(nameEntry.Text)
+		extra.tags = splitList(tagsEntry.Text)
+	}, confWindow)
+	labelsDialog.Resize(fyne.NewSize(500, 250))
+	labelsDialog.Show()
+}
+
 func deleteRow(row *fyne.Container) {
 	for i, r := range activRequstsRows {
 		if r.container == row {
@@ -83,11 +179,12 @@ func deleteRow(row *fyne.Container) {
 			break
 		}
 	}
+	delete(rowExtras, row)
 	requestsContainer.Remove(row)
 }
 
 func showConfReqWindow() {
-	confWindow := fyne.CurrentApp().NewWindow("Configure Requests")
+	confWindow = fyne.CurrentApp().NewWindow("Configure Requests")
 
 	requestsContainer = container.NewVBox()
 
@@ -96,63 +193,10 @@ func showConfReqWindow() {
 	}
 
 	for _, req := range activRequstsRows {
-		methodSelect := widget.NewSelect([]string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"}, nil)
-		methodSelect.SetSelected(req.method.Selected)
-
-		urlEntry := widget.NewEntry()
-		urlEntry.SetText(strings.TrimSpace(req.url.Text))
-
-		bodyEntry := widget.NewMultiLineEntry()
-		bodyEntry.SetText(req.body.Text)
-		if req.body.Text == "" {
-			bodyEntry.SetPlaceHolder("Request body (optional)")
-			bodyEntry.SetMinRowsVisible(1)
-		} else {
-			bodyEntry.SetPlaceHolder("")
-			if len(strings.Split(req.body.Text, "\n")) < 3 {
-				bodyEntry.SetMinRowsVisible(3)
-			} else {
-				bodyEntry.SetMinRowsVisible(len(strings.Split(req.body.Text, "\n")))
-			}
-		}
-
-		bodyEntry.OnChanged = func(s string) {
-			if s == "" {
-				bodyEntry.SetPlaceHolder("Request body (optional)")
-				bodyEntry.SetMinRowsVisible(1)
-			} else {
-				bodyEntry.SetPlaceHolder("")
-				if len(strings.Split(s, "\n")) < 3 {
-					bodyEntry.SetMinRowsVisible(3)
-				} else {
-					bodyEntry.SetMinRowsVisible(len(strings.Split(s, "\n")))
-				}
-			}
-		}
-
-		var row *fyne.Container
-
-		deleteButton := widget.NewButton("❌", func() {
-			deleteRow(row)
-		})
-
-		split1 := container.NewHSplit(methodSelect, urlEntry)
-		split1.Offset = 0.01
-		split2 := container.NewHSplit(bodyEntry, deleteButton)
-		split2.Offset = 0.99
-
-		row = container.NewAdaptiveGrid(1,
-			container.NewHSplit(
-				split1,
-				split2,
-			),
-		)
-
-		req.method = methodSelect
-		req.url = urlEntry
-		req.body = bodyEntry
-		req.delete = deleteButton
+		row := newRequestRow(req.method.Selected, strings.TrimSpace(req.url.Text), req.body.Text)
+		req.method, req.url, req.body, req.delete, _ = rowWidgets(row)
 		req.container = row
+		rowExtras[row] = req.extra
 
 		requestsContainer.Add(row)
 	}
@@ -165,13 +209,40 @@ func showConfReqWindow() {
 		requestsContainer.Add(createRequestRow())
 	})
 
+	importCurlButton := widget.NewButton("Import cURL", func() {
+		showCurlImportDialog(confWindow)
+	})
+
+	importHARButton := widget.NewButton("Import HAR", func() {
+		showHARImportDialog(confWindow)
+	})
+
+	importOpenAPIButton := widget.NewButton("Import OpenAPI", func() {
+		showOpenAPIImportDialog(confWindow)
+	})
+
+	importPostmanButton := widget.NewButton("Import Postman", func() {
+		showPostmanImportDialog(confWindow)
+	})
+
+	recordButton := widget.NewButton("Record", func() {
+		showRecorderWindow(confWindow)
+	})
+
+	scenarioCheck = widget.NewCheck("Send requests in order as a scenario", nil)
+	scenarioCheck.SetChecked(scenarioMode)
+	if selectedProtocol != core.HTTP {
+		scenarioCheck.Disable()
+	}
+
 	clearButton := widget.NewButton("Clear", func() {
+		rowExtras = make(map[*fyne.Container]*rowExtra)
 		requestsContainer.Objects = nil
 		requestsContainer.Add(createRequestRow())
 	})
 
 	applyButton := widget.NewButton("Ok", func() {
-		if protocolWindowOpen {
+		if protocolWindowOpen || authWindowOpen || scriptWindowOpen || replayWindowOpen || recorderWindowOpen {
 			dialog.ShowInformation("Info", "Please close the settings window before exiting.", confWindow)
 			return
 		}
@@ -188,39 +259,12 @@ func showConfReqWindow() {
 
 		activRequstsRows = nil
 		activRequsts = nil
+		activScenario = nil
+		scenarioMode = scenarioCheck.Checked && selectedProtocol == core.HTTP
 
 		for _, obj := range requestsContainer.Objects {
 			if row, ok := obj.(*fyne.Container); ok {
-				hSplit, ok := row.Objects[0].(*container.Split)
-				if !ok {
-					continue
-				}
-				split1, ok := hSplit.Leading.(*container.Split)
-				if !ok {
-					continue
-				}
-
-				split2, ok := hSplit.Trailing.(*container.Split)
-				if !ok {
-					continue
-				}
-
-				methodSelect, ok := split1.Leading.(*widget.Select)
-				if !ok {
-					continue
-				}
-
-				urlEntry, ok := split1.Trailing.(*widget.Entry)
-				if !ok {
-					continue
-				}
-
-				bodyEntry, ok := split2.Leading.(*widget.Entry)
-				if !ok {
-					continue
-				}
-
-				deleteButton, ok := split2.Trailing.(*widget.Button)
+				methodSelect, urlEntry, bodyEntry, deleteButton, ok := rowWidgets(row)
 				if !ok {
 					continue
 				}
@@ -236,6 +280,7 @@ func showConfReqWindow() {
 						method:    methodSelect,
 						url:       urlEntry,
 						body:      bodyEntry,
+						extra:     rowExtras[row],
 						delete:    deleteButton,
 						container: row,
 					})
@@ -249,15 +294,38 @@ func showConfReqWindow() {
 							dialog.ShowInformation("Error", "Invalid request", confWindow)
 							return
 						}
-						newReq = &core.HTTPRequest{
+						if extra := rowExtras[row]; extra != nil && extra.header != nil {
+							req.Header = extra.header.Clone()
+							req.Host = req.Header.Get("Host")
+							req.Header.Del("Host")
+						}
+						httpReq := &core.HTTPRequest{
 							Request:    req,
 							CachedBody: []byte(bodyEntry.Text),
 						}
+						if extra := rowExtras[row]; extra != nil {
+							httpReq.Name = extra.name
+							httpReq.Group = extra.group
+							httpReq.Tags = extra.tags
+						}
+						if scenarioMode {
+							step := core.ScenarioStep{Request: httpReq}
+							if extra := rowExtras[row]; extra != nil {
+								step.Delay = extra.delay
+							}
+							activScenario = append(activScenario, step)
+						}
+						newReq = httpReq
 					case core.WS:
-						newReq = &core.WSRequest{
+						wsReq := &core.WSRequest{
 							URI:     urlEntry.Text,
 							Payload: []byte(bodyEntry.Text),
 						}
+						if extra := rowExtras[row]; extra != nil {
+							wsReq.Name = extra.name
+							wsReq.Tags = extra.tags
+						}
+						newReq = wsReq
 					default:
 						dialog.ShowInformation("Error", "Invalid protocol", confWindow)
 						return
@@ -270,7 +338,7 @@ func showConfReqWindow() {
 	})
 
 	confWindow.SetCloseIntercept(func() {
-		if protocolWindowOpen {
+		if protocolWindowOpen || authWindowOpen || scriptWindowOpen || replayWindowOpen || recorderWindowOpen {
 			dialog.ShowInformation("Info", "Please close the settings window before exiting.", confWindow)
 			return
 		}
@@ -280,7 +348,7 @@ func showConfReqWindow() {
 
 	content := container.NewBorder(
 		nil,
-		container.NewVBox(container.NewAdaptiveGrid(2, clearButton, addButton), protocolButton, applyButton),
+		container.NewVBox(container.NewAdaptiveGrid(2, clearButton, addButton), container.NewAdaptiveGrid(5, importCurlButton, importHARButton, importOpenAPIButton, importPostmanButton, recordButton), scenarioCheck, container.NewAdaptiveGrid(4, protocolButton, authButton, scriptButton, replayButton), applyButton),
 		nil,
 		nil,
 		container.NewVScroll(requestsContainer),
@@ -0,0 +1,247 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/prorok210/TestYourServer/core"
+)
+
+var (
+	historyButton     *widget.Button
+	historyWindowOpen bool
+	historyStore      *core.HistoryStore
+)
+
+func getHistoryStore() (*core.HistoryStore, error) {
+	if historyStore != nil {
+		return historyStore, nil
+	}
+
+	dir, err := core.DefaultHistoryDir()
+	if err != nil {
+		return nil, err
+	}
+
+	historyStore, err = core.NewHistoryStore(dir)
+	return historyStore, err
+}
+
+func saveToHistory(report *core.TestReport) {
+	if report == nil || len(report.Requests) == 0 {
+		return
+	}
+
+	store, err := getHistoryStore()
+	if err != nil {
+		fmt.Println("failed to open history:", err)
+		return
+	}
+
+	if err := store.Save(report); err != nil {
+		fmt.Println("failed to save run to history:", err)
+	}
+}
+
+func runLabel(run *core.TestReport) string {
+	count, errorsCount := 0, 0
+	for _, rep := range run.Requests {
+		count += rep.Count
+		errorsCount += rep.ErrorCount()
+	}
+	return fmt.Sprintf("%s  %s, %d clients, %d requests, %d errors",
+		run.Started.Format("2006-01-02 15:04:05"), run.Config.Protocol, run.Config.Count_Workers, count, errorsCount)
+}
+
+func showHistoryWindow() {
+	if historyWindowOpen {
+		return
+	}
+
+	store, err := getHistoryStore()
+	if err != nil {
+		dialog.ShowInformation("Error", err.Error(), window)
+		return
+	}
+
+	historyWindowOpen = true
+	historyWindow := fyne.CurrentApp().NewWindow("History")
+	historyWindow.SetOnClosed(func() {
+		historyWindowOpen = false
+	})
+
+	var runs []*core.TestReport
+	selected := -1
+
+	list := widget.NewList(
+		func() int { return len(runs) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			obj.(*widget.Label).SetText(runLabel(runs[id]))
+		},
+	)
+	list.OnSelected = func(id widget.ListItemID) {
+		selected = id
+	}
+
+	baselineSelect := widget.NewSelect(nil, nil)
+	baselineSelect.PlaceHolder = "Baseline run"
+	currentSelect := widget.NewSelect(nil, nil)
+	currentSelect.PlaceHolder = "Run to compare"
+
+	toleranceEntry := widget.NewEntry()
+	toleranceEntry.SetText(strconv.Itoa(int(core.DEFAULT_REGRESSION_TOLERANCE * 100)))
+
+	reload := func() {
+		runs, err = store.List()
+		if err != nil {
+			dialog.ShowInformation("Error", err.Error(), historyWindow)
+		}
+		selected = -1
+		list.UnselectAll()
+		list.Refresh()
+
+		options := make([]string, 0, len(runs))
+		for _, run := range runs {
+			options = append(options, runLabel(run))
+		}
+		baselineSelect.Options = options
+		baselineSelect.ClearSelected()
+		currentSelect.Options = options
+		currentSelect.ClearSelected()
+	}
+	reload()
+
+	openButton := widget.NewButton("Open report", func() {
+		if selected < 0 || selected >= len(runs) {
+			dialog.ShowInformation("Info", "Select a run first", historyWindow)
+			return
+		}
+		run := runs[selected]
+		runWindow := fyne.CurrentApp().NewWindow("Report " + run.Started.Format("2006-01-02 15:04:05"))
+		runWindow.SetContent(createReportContent(run))
+		runWindow.Resize(fyne.NewSize(800, 600))
+		runWindow.Show()
+	})
+
+	deleteButton := widget.NewButton("Delete", func() {
+		if selected < 0 || selected >= len(runs) {
+			dialog.ShowInformation("Info", "Select a run first", historyWindow)
+			return
+		}
+		run := runs[selected]
+		dialog.ShowConfirm("Delete run", "Delete the run from "+run.Started.Format("2006-01-02 15:04:05")+"?", func(ok bool) {
+			if !ok {
+				return
+			}
+			if err := store.Delete(run.ID); err != nil {
+				dialog.ShowInformation("Error", err.Error(), historyWindow)
+			}
+			reload()
+		}, historyWindow)
+	})
+
+	compareButton := widget.NewButton("Compare", func() {
+		baseIndex, curIndex := baselineSelect.SelectedIndex(), currentSelect.SelectedIndex()
+		if baseIndex < 0 || curIndex < 0 {
+			dialog.ShowInformation("Info", "Select two runs to compare", historyWindow)
+			return
+		}
+
+		tolerance, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(toleranceEntry.Text), "%"), 64)
+		if err != nil || tolerance <= 0 {
+			dialog.ShowInformation("Error", "Tolerance must be a positive number of percent", historyWindow)
+			return
+		}
+
+		showComparisonWindow(core.CompareReports(runs[baseIndex], runs[curIndex], tolerance/100))
+	})
+
+	compareBox := container.NewVBox(
+		widget.NewLabelWithStyle("Compare runs", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		baselineSelect,
+		currentSelect,
+		container.NewBorder(nil, nil, widget.NewLabel("Regression tolerance, %"), nil, toleranceEntry),
+		compareButton,
+	)
+
+	historyWindow.SetContent(container.NewBorder(
+		nil,
+		container.NewVBox(container.NewAdaptiveGrid(2, openButton, deleteButton), widget.NewSeparator(), compareBox),
+		nil,
+		nil,
+		list,
+	))
+	historyWindow.Resize(fyne.NewSize(800, 600))
+	historyWindow.Show()
+}
+
+func showComparisonWindow(comparison *core.Comparison) {
+	comparisonWindow := fyne.CurrentApp().NewWindow("Comparison")
+
+	summary := "No regressions beyond the tolerance."
+	if comparison.HasRegressions() {
+		summary = "Regressions found, see the highlighted metrics."
+	}
+
+	sections := []fyne.CanvasObject{
+		widget.NewLabel(fmt.Sprintf("Baseline: %s\nCompared: %s\nTolerance: %.0f%%",
+			runLabel(comparison.Baseline), runLabel(comparison.Current), comparison.Tolerance*100)),
+		widget.NewLabelWithStyle(summary, fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		widget.NewSeparator(),
+	}
+
+	for _, endpoint := range comparison.Endpoints {
+		name := endpoint.Url
+		if endpoint.Name != "" {
+			name = endpoint.Name + ", " + endpoint.Url
+		}
+		title := widget.NewLabelWithStyle(core.TruncateString(name, MAX_URL_LEN), fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+		if endpoint.Regression {
+			title.Importance = widget.DangerImportance
+		}
+		sections = append(sections, title)
+
+		if endpoint.Missing {
+			sections = append(sections, widget.NewLabel("Present in only one of the runs."), widget.NewSeparator())
+			continue
+		}
+
+		grid := container.NewGridWithColumns(4,
+			widget.NewLabelWithStyle("Metric", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+			widget.NewLabelWithStyle("Baseline", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+			widget.NewLabelWithStyle("Compared", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+			widget.NewLabelWithStyle("Change", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		)
+		for _, metric := range endpoint.Metrics {
+			change := widget.NewLabel(formatChange(metric.Change))
+			if metric.Regression {
+				change.Importance = widget.DangerImportance
+				change.TextStyle = fyne.TextStyle{Bold: true}
+			}
+			grid.Add(widget.NewLabel(metric.Name))
+			grid.Add(widget.NewLabel(fmt.Sprintf("%.2f", metric.Baseline)))
+			grid.Add(widget.NewLabel(fmt.Sprintf("%.2f", metric.Current)))
+			grid.Add(change)
+		}
+
+		sections = append(sections, grid, widget.NewSeparator())
+	}
+
+	comparisonWindow.SetContent(container.NewVScroll(container.NewVBox(sections...)))
+	comparisonWindow.Resize(fyne.NewSize(800, 600))
+	comparisonWindow.Show()
+}
+
+func formatChange(change float64) string {
+	if math.IsInf(change, 0) {
+		return "new"
+	}
+	return fmt.Sprintf("%+.1f%%", change*100)
+}
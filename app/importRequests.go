@@ -0,0 +1,376 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+	"github.com/prorok210/TestYourServer/core"
+)
+
+const (
+	MAX_IMPORT_WARNINGS = 10
+)
+
+// addImportedRows appends a row for every step, replacing the single empty
+// row a new window starts with. A row the user typed into is kept.
+func addImportedRows(steps []core.ScenarioStep, parent fyne.Window) bool {
+	placeholder := false
+	if len(requestsContainer.Objects) == 1 {
+		row, ok := requestsContainer.Objects[0].(*fyne.Container)
+		placeholder = ok && isPlaceholderRow(row)
+	}
+	existing := len(requestsContainer.Objects)
+	if placeholder {
+		existing = 0
+	}
+	if existing+len(steps) > MAX_COUNT_REQS {
+		dialog.ShowInformation("Error", fmt.Sprintf("You can add a maximum of %d requests, %d were found", MAX_COUNT_REQS, len(steps)), parent)
+		return false
+	}
+	if placeholder {
+		requestsContainer.Objects = nil
+	}
+
+	for _, step := range steps {
+		req := step.Request
+		row := newRequestRow(req.Method, req.URL.String(), string(req.CachedBody))
+		header := req.Header.Clone()
+		if req.Host != "" && req.Host != req.URL.Host {
+			header.Set("Host", req.Host)
+		}
+		rowExtras[row] = &rowExtra{name: req.Name, group: req.Group, tags: req.Tags, header: header, delay: step.Delay}
+		requestsContainer.Add(row)
+	}
+	requestsContainer.Refresh()
+
+	return true
+}
+
+func isPlaceholderRow(row *fyne.Container) bool {
+	_, urlEntry, bodyEntry, _, ok := rowWidgets(row)
+	return ok && rowExtras[row] == nil && strings.TrimSpace(urlEntry.Text) == "" && strings.TrimSpace(bodyEntry.Text) == ""
+}
+
+func showCurlImportDialog(parent fyne.Window) {
+	if selectedProtocol != core.HTTP {
+		dialog.ShowInformation("Error", "cURL commands can only be imported for the HTTP protocol", parent)
+		return
+	}
+
+	curlEntry := widget.NewMultiLineEntry()
+	curlEntry.SetPlaceHolder("curl -X POST https://example.com/api -H 'Content-Type: application/json' -d '{}'")
+	curlEntry.SetMinRowsVisible(8)
+
+	importDialog := dialog.NewCustomConfirm("Import cURL", "Import", "Cancel", curlEntry, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		imported, err := core.ParseCurlCommands(curlEntry.Text)
+		if err != nil {
+			dialog.ShowInformation("Error", err.Error(), parent)
+			return
+		}
+
+		steps := make([]core.ScenarioStep, 0, len(imported))
+		insecure := false
+		for _, curlReq := range imported {
+			steps = append(steps, core.ScenarioStep{Request: curlReq.Request})
+			insecure = insecure || curlReq.Insecure
+		}
+		if !addImportedRows(steps, parent) {
+			return
+		}
+
+		message := fmt.Sprintf("Imported %d requests.", len(imported))
+		if insecure {
+			message += "\nThe command used -k but TLS checking is still on, disable it in the protocol window if the server needs it."
+		}
+		dialog.ShowInformation("Import cURL", message, parent)
+	}, parent)
+	importDialog.Resize(fyne.NewSize(700, 300))
+	importDialog.Show()
+}
+
+// openImportFile lets the user pick a file and passes its contents on.
+func openImportFile(parent fyne.Window, extensions []string, onRead func(data []byte)) {
+	fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			dialog.ShowInformation("Error", err.Error(), parent)
+			return
+		}
+		if reader == nil {
+			return
+		}
+		defer reader.Close()
+
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			dialog.ShowInformation("Error", err.Error(), parent)
+			return
+		}
+
+		onRead(data)
+	}, parent)
+	fileDialog.SetFilter(storage.NewExtensionFileFilter(extensions))
+	fileDialog.Show()
+}
+
+func showHARImportDialog(parent fyne.Window) {
+	if selectedProtocol != core.HTTP {
+		dialog.ShowInformation("Error", "HAR files can only be imported for the HTTP protocol", parent)
+		return
+	}
+
+	openImportFile(parent, []string{".har", ".json"}, func(data []byte) {
+		showHARFilterDialog(data, parent)
+	})
+}
+
+func showHARFilterDialog(data []byte, parent fyne.Window) {
+	domainsEntry := widget.NewEntry()
+	domainsEntry.SetPlaceHolder("example.com, api.example.com (empty for all)")
+
+	contentTypesEntry := widget.NewEntry()
+	contentTypesEntry.SetPlaceHolder("json, html (empty for all)")
+
+	skipStaticCheck := widget.NewCheck("Skip static assets (images, fonts, CSS, scripts, media)", nil)
+	skipStaticCheck.SetChecked(true)
+
+	asScenarioCheck := widget.NewCheck("Send in recorded order with the original timing", nil)
+	asScenarioCheck.SetChecked(true)
+
+	form := container.NewVBox(
+		widget.NewLabel("Only these domains:"),
+		domainsEntry,
+		widget.NewLabel("Only these response content types:"),
+		contentTypesEntry,
+		skipStaticCheck,
+		asScenarioCheck,
+	)
+
+	filterDialog := dialog.NewCustomConfirm("Import HAR", "Import", "Cancel", form, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		filter := core.HARFilter{
+			Domains:      splitList(domainsEntry.Text),
+			ContentTypes: splitList(contentTypesEntry.Text),
+			DropCookies:  cookiesEnabled,
+		}
+		if skipStaticCheck.Checked {
+			filter.ExcludeContentTypes = core.StaticContentTypes
+		}
+
+		steps, err := core.ImportHAR(bytes.NewReader(data), filter)
+		if err != nil {
+			dialog.ShowInformation("Error", err.Error(), parent)
+			return
+		}
+		if !addImportedRows(steps, parent) {
+			return
+		}
+
+		if asScenarioCheck.Checked {
+			scenarioCheck.SetChecked(true)
+		}
+		dialog.ShowInformation("Import HAR", fmt.Sprintf("Imported %d requests.", len(steps)), parent)
+	}, parent)
+	filterDialog.Resize(fyne.NewSize(600, 350))
+	filterDialog.Show()
+}
+
+func showOpenAPIImportDialog(parent fyne.Window) {
+	if selectedProtocol != core.HTTP {
+		dialog.ShowInformation("Error", "OpenAPI specifications can only be imported for the HTTP protocol", parent)
+		return
+	}
+
+	openImportFile(parent, []string{".json", ".yaml", ".yml"}, func(data []byte) {
+		spec, err := core.ParseOpenAPI(data)
+		if err != nil {
+			dialog.ShowInformation("Error", err.Error(), parent)
+			return
+		}
+		showOpenAPIOperationsDialog(spec, parent)
+	})
+}
+
+func showOpenAPIOperationsDialog(spec *core.OpenAPISpec, parent fyne.Window) {
+	baseURLEntry := widget.NewSelectEntry(spec.Servers)
+	baseURLEntry.SetPlaceHolder("https://api.example.com")
+	baseURLLabel := widget.NewLabel("Base URL:")
+	for _, server := range spec.Servers {
+		if core.IsAbsoluteServerURL(server) {
+			baseURLEntry.SetText(server)
+			break
+		}
+	}
+	if baseURLEntry.Text == "" && len(spec.Servers) > 0 {
+		// Relative servers need the host the specification is served from.
+		baseURLEntry.SetPlaceHolder("https://api.example.com" + spec.Servers[0])
+		baseURLLabel.SetText(fmt.Sprintf("Base URL (the specification gives only %s without a host):", spec.Servers[0]))
+	}
+
+	labels := make([]string, 0, len(spec.Operations))
+	byLabel := make(map[string]*core.OpenAPIOperation, len(spec.Operations))
+	for _, op := range spec.Operations {
+		label := fmt.Sprintf("%s  %s %s", op.ID, op.Method, op.Path)
+		if op.Summary != "" {
+			label += " - " + op.Summary
+		}
+		labels = append(labels, label)
+		byLabel[label] = op
+	}
+
+	operationsGroup := widget.NewCheckGroup(labels, nil)
+	operationsGroup.SetSelected(labels)
+
+	selectAllButton := widget.NewButton("Select all", func() {
+		operationsGroup.SetSelected(labels)
+	})
+	selectNoneButton := widget.NewButton("Select none", func() {
+		operationsGroup.SetSelected(nil)
+	})
+
+	content := container.NewBorder(
+		container.NewVBox(
+			baseURLLabel,
+			baseURLEntry,
+			container.NewAdaptiveGrid(2, selectAllButton, selectNoneButton),
+		),
+		nil,
+		nil,
+		nil,
+		container.NewVScroll(operationsGroup),
+	)
+
+	title := "Import OpenAPI"
+	if spec.Title != "" {
+		title += ": " + spec.Title
+	}
+
+	operationsDialog := dialog.NewCustomConfirm(title, "Import", "Cancel", content, func(ok bool) {
+		if !ok {
+			return
+		}
+		if len(operationsGroup.Selected) == 0 {
+			dialog.ShowInformation("Error", "No operations selected", parent)
+			return
+		}
+
+		selected := make(map[string]bool, len(operationsGroup.Selected))
+		for _, label := range operationsGroup.Selected {
+			selected[label] = true
+		}
+
+		// Keep the order of the specification, not the order of clicks.
+		var steps []core.ScenarioStep
+		for _, label := range labels {
+			if !selected[label] {
+				continue
+			}
+			req, err := byLabel[label].NewRequest(baseURLEntry.Text)
+			if err != nil {
+				dialog.ShowInformation("Error", err.Error(), parent)
+				return
+			}
+			steps = append(steps, core.ScenarioStep{Request: req})
+		}
+
+		if addImportedRows(steps, parent) {
+			dialog.ShowInformation("Import OpenAPI", fmt.Sprintf("Imported %d requests.", len(steps)), parent)
+		}
+	}, parent)
+	operationsDialog.Resize(fyne.NewSize(800, 600))
+	operationsDialog.Show()
+}
+
+func showPostmanImportDialog(parent fyne.Window) {
+	if selectedProtocol != core.HTTP {
+		dialog.ShowInformation("Error", "Postman collections can only be imported for the HTTP protocol", parent)
+		return
+	}
+
+	openImportFile(parent, []string{".json"}, func(collection []byte) {
+		var environment []byte
+
+		envLabel := widget.NewLabel("Environment: none")
+		envButton := widget.NewButton("Choose environment file", func() {
+			openImportFile(parent, []string{".json"}, func(data []byte) {
+				environment = data
+				envLabel.SetText("Environment: loaded")
+			})
+		})
+		clearEnvButton := widget.NewButton("No environment", func() {
+			environment = nil
+			envLabel.SetText("Environment: none")
+		})
+
+		content := container.NewVBox(
+			widget.NewLabel("Variables like {{baseUrl}} are filled from the collection\nand the environment, the environment wins."),
+			envLabel,
+			container.NewAdaptiveGrid(2, envButton, clearEnvButton),
+		)
+
+		dialog.ShowCustomConfirm("Import Postman", "Import", "Cancel", content, func(ok bool) {
+			if !ok {
+				return
+			}
+
+			var env map[string]string
+			if environment != nil {
+				var err error
+				if env, err = core.ParsePostmanEnvironment(bytes.NewReader(environment)); err != nil {
+					dialog.ShowInformation("Error", err.Error(), parent)
+					return
+				}
+			}
+
+			imported, err := core.ImportPostman(bytes.NewReader(collection), env)
+			if err != nil {
+				dialog.ShowInformation("Error", err.Error(), parent)
+				return
+			}
+
+			steps := make([]core.ScenarioStep, 0, len(imported.Requests))
+			for _, req := range imported.Requests {
+				steps = append(steps, core.ScenarioStep{Request: req})
+			}
+			if !addImportedRows(steps, parent) {
+				return
+			}
+
+			message := fmt.Sprintf("Imported %d requests.", len(steps))
+			if len(imported.Warnings) > 0 {
+				message += "\n\nSkipped or incomplete:"
+				for i, warning := range imported.Warnings {
+					if i == MAX_IMPORT_WARNINGS {
+						message += fmt.Sprintf("\n  ...and %d more", len(imported.Warnings)-i)
+						break
+					}
+					message += "\n  - " + core.WrapText(warning, MAX_ROW_LEN)
+				}
+			}
+			dialog.ShowInformation("Import Postman", message, parent)
+		}, parent)
+	})
+}
+
+func splitList(text string) []string {
+	var items []string
+	for _, item := range strings.Split(text, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
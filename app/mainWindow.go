@@ -21,6 +21,8 @@ const (
 	REQ_DELAY_STEP             = 1.0
 	TEST_DURATION_STEP         = 0.5
 	UPDATE_SLIDERS_ENTRY_DELAY = 10 * time.Millisecond
+	// Wait for the sliders to settle before changing the running test
+	APPLY_LIVE_LOAD_DELAY = 300 * time.Millisecond
 )
 
 var (
@@ -31,6 +33,10 @@ var (
 	testButton  *widget.Button
 	testIsActiv bool
 
+	// Pause button and the control of the running test
+	pauseButton *widget.Button
+	testControl *core.TestControl
+
 	// Information about requests
 	infoReqsGrid *widget.TextGrid
 
@@ -53,12 +59,20 @@ var (
 	delayEntry    *widget.Entry
 	durationEntry *widget.Entry
 	workersEntry  *widget.Entry
+	// Requests per second of all clients, replaces the delay when set
+	rateEntry *widget.Entry
 
 	// Options for showing request
 	showRequest *widget.Check
 	showTime    *widget.Check
 	showBody    *widget.Check
 	showHeaders *widget.Check
+	showCookies *widget.Check
+	discardBody *widget.Check
+
+	// Result log written during the test
+	writeResultLog  *widget.Check
+	resultLogFormat *widget.Select
 
 	// Context for testing
 	testCtx          context.Context
@@ -100,6 +114,9 @@ func CreateAppWindow() {
 	workersEntry.SetText(fmt.Sprintf("%v", core.DEFAULT_COUNT_WORKERS))
 	workersEntry.Resize(fyne.NewSize(100, 1000))
 
+	rateEntry = widget.NewEntry()
+	rateEntry.SetPlaceHolder("empty to use the request delay")
+
 	// Stats label
 	StatsLabel = widget.NewLabel("Time left: 00:00\nTime elapsed: 00:00\nRequests sent: 0\nRequests failed: 0")
 
@@ -116,9 +133,23 @@ func CreateAppWindow() {
 		})
 	}
 
+	var loadTimer *time.Timer
+
+	applyLoad := func() {
+		if !testIsActiv {
+			return
+		}
+		if loadTimer != nil {
+			loadTimer.Stop()
+		}
+
+		loadTimer = time.AfterFunc(APPLY_LIVE_LOAD_DELAY, applyLiveLoad)
+	}
+
 	delaySlider.OnChanged = func(f float64) {
 		delayValStr = fmt.Sprintf("%v ms", f)
 		updateUI(delayValStr, delayEntry.SetText)
+		applyLoad()
 	}
 	durationSlider.OnChanged = func(f float64) {
 		durationValStr = fmt.Sprintf("%v min", f)
@@ -127,6 +158,7 @@ func CreateAppWindow() {
 	workersSlider.OnChanged = func(f float64) {
 		workersValStr := fmt.Sprintf("%d", int(f))
 		updateUI(workersValStr, workersEntry.SetText)
+		applyLoad()
 	}
 
 	// OnChanged for entries
@@ -190,19 +222,43 @@ func CreateAppWindow() {
 		}
 	}
 
+	rateEntry.OnChanged = func(string) {
+		updateDelayInputs()
+		applyLoad()
+	}
+
 	showRequest = widget.NewCheck("Show request", nil)
 	showTime = widget.NewCheck("Show response Time", nil)
 	showBody = widget.NewCheck("Show response Body (only first 1000 bytes)", nil)
 	showHeaders = widget.NewCheck("Show response Headers (only first 10 headers)", nil)
+	showCookies = widget.NewCheck("Show cookies count", nil)
+	discardBody = widget.NewCheck("Discard response bodies (saves memory on large responses)", nil)
+	resultLogFormat = widget.NewSelect([]string{core.RESULT_LOG_JSONL.String(), core.RESULT_LOG_CSV.String()}, nil)
+	resultLogFormat.SetSelected(core.RESULT_LOG_JSONL.String())
+	resultLogFormat.Disable()
+	writeResultLog = widget.NewCheck("Write every result to a compressed log file", func(checked bool) {
+		if checked {
+			resultLogFormat.Enable()
+		} else {
+			resultLogFormat.Disable()
+		}
+	})
 
 	testCtx, testCancel = context.Background(), func() {}
 	displayCtx, displayCtxCancel = context.Background(), func() {}
 
 	testButton = widget.NewButton("Start testing", testButtonFunc)
+	pauseButton = widget.NewButton("Pause", pauseButtonFunc)
+	pauseButton.Disable()
 
 	reportButton = widget.NewButton("Show report", showReport)
+	historyButton = widget.NewButton("History", showHistoryWindow)
+	targetButton = widget.NewButton("Target server", showTargetWindow)
 
 	protocolButton = widget.NewButton("Change protocol", showProtocolWindow)
+	authButton = widget.NewButton("Authentication", showAuthWindow)
+	scriptButton = widget.NewButton("Script", showScriptWindow)
+	replayButton = widget.NewButton("Replay log", showReplayWindow)
 	selectedProtocol = core.DEFAULT_PROTO
 
 	configRequestsButton = widget.NewButton("Configurate requests", func() {
@@ -240,6 +296,10 @@ func CreateAppWindow() {
 		container.NewGridWrap(fyne.NewSize(300, 40), workersSlider),
 		container.NewGridWrap(fyne.NewSize(70, 40), workersEntry),
 	)
+	rateContainer := container.NewHBox(
+		widget.NewLabel("Target rate, req/s"),
+		container.NewGridWrap(fyne.NewSize(300, 40), rateEntry),
+	)
 
 	// Wrap output in scroll container
 	scrollOutput := container.NewScroll(infoReqsGrid)
@@ -254,11 +314,15 @@ func CreateAppWindow() {
 			showBody,
 			showHeaders,
 			showTime,
+			showCookies,
+			discardBody,
+			container.NewHBox(writeResultLog, resultLogFormat),
 		)),
 		widget.NewCard("Settings", "", container.NewVBox(
 			delayContainer,
 			durationContainer,
 			workersContainer,
+			rateContainer,
 			configRequestsButton,
 		)),
 	)
@@ -267,7 +331,10 @@ func CreateAppWindow() {
 	bottomPanel := container.NewHBox(
 		layout.NewSpacer(),
 		reportButton,
+		historyButton,
+		targetButton,
 		layout.NewSpacer(),
+		pauseButton,
 		testButton,
 		layout.NewSpacer(),
 	)
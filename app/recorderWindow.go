@@ -0,0 +1,242 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+	"github.com/prorok210/TestYourServer/core"
+)
+
+const (
+	UPDATE_RECORDER_STATS_DELAY = time.Second
+)
+
+var (
+	recorderWindowOpen bool
+	// recorderMu guards recorder, the stats ticker reads it too.
+	recorderMu     sync.Mutex
+	recorder       *core.Recorder
+	recorderConfig = core.RecorderConfig{Addr: core.DEFAULT_RECORDER_ADDR}
+)
+
+func currentRecorder() *core.Recorder {
+	recorderMu.Lock()
+	defer recorderMu.Unlock()
+	return recorder
+}
+
+// showRecorderWindow records requests through a local proxy and adds them to
+// the rows of the Configure Requests window. The recorder stops with the
+// window.
+func showRecorderWindow(parent fyne.Window) {
+	if recorderWindowOpen {
+		return
+	}
+	if selectedProtocol != core.HTTP {
+		dialog.ShowInformation("Error", "Requests can only be recorded for the HTTP protocol", parent)
+		return
+	}
+	recorderWindowOpen = true
+
+	recorderWindow := fyne.CurrentApp().NewWindow("Record requests")
+
+	addrEntry := widget.NewEntry()
+	addrEntry.SetText(recorderConfig.Addr)
+	targetEntry := widget.NewEntry()
+	targetEntry.SetPlaceHolder("empty to use it as a proxy, or http://localhost:8080")
+	targetEntry.SetText(recorderConfig.Target)
+
+	form := widget.NewForm(
+		widget.NewFormItem("Address", addrEntry),
+		widget.NewFormItem("Target", targetEntry),
+	)
+
+	domainsEntry := widget.NewEntry()
+	domainsEntry.SetPlaceHolder("Only these domains: example.com, api.example.com (empty for all)")
+	skipStaticCheck := widget.NewCheck("Skip static assets (images, fonts, CSS, scripts, media)", nil)
+	skipStaticCheck.SetChecked(true)
+	asScenarioCheck := widget.NewCheck("Send in recorded order with the original timing", nil)
+	asScenarioCheck.SetChecked(true)
+
+	statusLabel := widget.NewLabel("")
+	statusLabel.Wrapping = fyne.TextWrapWord
+
+	var startButton, importButton, saveButton, clearButton *widget.Button
+
+	// update and stop are called with recorderMu held.
+	update := func() {
+		if recorder == nil {
+			statusLabel.SetText("Stopped. Start the recorder, then set it as the HTTP proxy of a browser or client, " +
+				"or set a target and send the requests to the recorder instead.")
+			startButton.SetText("Start")
+			form.Enable()
+			importButton.Disable()
+			saveButton.Disable()
+			clearButton.Disable()
+			return
+		}
+
+		recorded, skipped := recorder.Count()
+		status := fmt.Sprintf("Recording at %s", recorder.URL())
+		if recorder.Target() != "" {
+			status += ", forwarding to " + recorder.Target()
+		}
+		status += fmt.Sprintf("\nRequests recorded: %d", recorded)
+		if skipped > 0 {
+			status += fmt.Sprintf(", %d more were not recorded, the limit is %d", skipped, core.MAX_RECORDED_REQUESTS)
+		}
+		if tunneled := recorder.Tunneled(); len(tunneled) > 0 {
+			status += "\nHTTPS can't be recorded through the proxy, passed on: " + core.TruncateString(strings.Join(tunneled, ", "), MAX_ROW_LEN)
+		}
+		statusLabel.SetText(status)
+		startButton.SetText("Stop")
+		form.Disable()
+		importButton.Enable()
+		saveButton.Enable()
+		clearButton.Enable()
+	}
+
+	stop := func() {
+		if recorder == nil {
+			return
+		}
+		if err := recorder.Close(); err != nil {
+			fmt.Println("failed to stop the recorder:", err)
+		}
+		recorder = nil
+	}
+
+	startButton = widget.NewButton("Start", func() {
+		recorderMu.Lock()
+		defer recorderMu.Unlock()
+
+		if recorder != nil {
+			stop()
+			update()
+			return
+		}
+
+		config := core.RecorderConfig{Addr: strings.TrimSpace(addrEntry.Text), Target: strings.TrimSpace(targetEntry.Text)}
+		rec, err := core.StartRecorder(config)
+		if err != nil {
+			dialog.ShowInformation("Error", err.Error(), recorderWindow)
+			return
+		}
+		recorderConfig = config
+		recorder = rec
+		update()
+	})
+
+	importButton = widget.NewButton("Add to requests", func() {
+		if !confWindowOpen {
+			dialog.ShowInformation("Error", "Open the Configure Requests window to add the recorded requests", recorderWindow)
+			return
+		}
+
+		rec := currentRecorder()
+		if rec == nil {
+			return
+		}
+		filter := core.HARFilter{Domains: splitList(domainsEntry.Text), DropCookies: cookiesEnabled}
+		if skipStaticCheck.Checked {
+			filter.ExcludeContentTypes = core.StaticContentTypes
+		}
+		steps, err := rec.Steps(filter)
+		if err != nil {
+			dialog.ShowInformation("Error", err.Error(), recorderWindow)
+			return
+		}
+		if !addImportedRows(steps, recorderWindow) {
+			return
+		}
+		if asScenarioCheck.Checked {
+			scenarioCheck.SetChecked(true)
+		}
+		dialog.ShowInformation("Record requests", fmt.Sprintf("Added %d requests.", len(steps)), recorderWindow)
+	})
+
+	saveButton = widget.NewButton("Save HAR", func() {
+		rec := currentRecorder()
+		if rec == nil {
+			return
+		}
+		records := rec.Records()
+		saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				dialog.ShowInformation("Error", err.Error(), recorderWindow)
+				return
+			}
+			if writer == nil {
+				return
+			}
+			defer writer.Close()
+
+			if err := core.WriteHAR(writer, records); err != nil {
+				dialog.ShowInformation("Error", err.Error(), recorderWindow)
+			}
+		}, recorderWindow)
+		saveDialog.SetFileName("recording.har")
+		saveDialog.SetFilter(storage.NewExtensionFileFilter([]string{".har"}))
+		saveDialog.Show()
+	})
+
+	clearButton = widget.NewButton("Clear", func() {
+		recorderMu.Lock()
+		defer recorderMu.Unlock()
+
+		if recorder != nil {
+			recorder.Clear()
+		}
+		update()
+	})
+
+	recorderMu.Lock()
+	update()
+	recorderMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(UPDATE_RECORDER_STATS_DELAY)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				recorderMu.Lock()
+				if recorder != nil {
+					update()
+				}
+				recorderMu.Unlock()
+			}
+		}
+	}()
+
+	recorderWindow.SetOnClosed(func() {
+		close(done)
+		recorderMu.Lock()
+		stop()
+		recorderMu.Unlock()
+		recorderWindowOpen = false
+	})
+
+	recorderWindow.SetContent(container.NewVBox(
+		form,
+		container.NewAdaptiveGrid(2, startButton, clearButton),
+		statusLabel,
+		widget.NewSeparator(),
+		domainsEntry,
+		skipStaticCheck,
+		asScenarioCheck,
+		container.NewAdaptiveGrid(2, importButton, saveButton),
+	))
+	recorderWindow.Resize(fyne.NewSize(650, 400))
+	recorderWindow.Show()
+}
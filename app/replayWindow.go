@@ -0,0 +1,125 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/prorok210/TestYourServer/core"
+)
+
+var (
+	replayButton     *widget.Button
+	replayWindowOpen bool
+	activReplay      *core.ReplayConfig
+)
+
+func showReplayWindow() {
+	if replayWindowOpen {
+		return
+	}
+	replayWindowOpen = true
+
+	replayWindow := fyne.CurrentApp().NewWindow("Replay access log")
+
+	pathEntry := widget.NewEntry()
+	pathEntry.SetPlaceHolder("access.log, access.jsonl or access.log.gz")
+	targetEntry := widget.NewEntry()
+	targetEntry.SetPlaceHolder("http://staging:8080, empty to use the logged hosts")
+	speedEntry := widget.NewEntry()
+	speedEntry.SetText(strconv.FormatFloat(core.DEFAULT_REPLAY_SPEED, 'f', -1, 64))
+
+	statusLabel := widget.NewLabel("No replay, requests are sent as configured.")
+	if activReplay != nil {
+		pathEntry.SetText(activReplay.Path)
+		targetEntry.SetText(activReplay.Target)
+		speedEntry.SetText(strconv.FormatFloat(activReplay.Speed, 'f', -1, 64))
+		statusLabel.SetText("Replay active, the configured requests are not sent.")
+	} else if targetServer != nil {
+		targetEntry.SetText(targetServer.URL())
+	}
+
+	browseButton := widget.NewButton("Browse", func() {
+		dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil {
+				dialog.ShowInformation("Error", err.Error(), replayWindow)
+				return
+			}
+			if reader == nil {
+				return
+			}
+			reader.Close()
+			pathEntry.SetText(reader.URI().Path())
+		}, replayWindow)
+	})
+
+	helpLabel := widget.NewLabel(core.WrapText("Sends the requests of an access log in Common, Combined or JSON Lines format "+
+		"with their original timing. Speed 2 replays twice as fast, the count of clients caps the requests in flight "+
+		"and the test ends after the last entry or the test duration.", MAX_ROW_LEN))
+
+	form := widget.NewForm(
+		widget.NewFormItem("Access log", container.NewBorder(nil, nil, nil, browseButton, pathEntry)),
+		widget.NewFormItem("Target", targetEntry),
+		widget.NewFormItem("Speed", speedEntry),
+	)
+
+	clearButton := widget.NewButton("Remove replay", func() {
+		activReplay = nil
+		replayWindow.Close()
+	})
+
+	okButton := widget.NewButton("OK", func() {
+		replay, err := parseReplayForm(pathEntry.Text, targetEntry.Text, speedEntry.Text)
+		if err != nil {
+			dialog.ShowInformation("Error", core.WrapText(err.Error(), MAX_ROW_LEN), replayWindow)
+			return
+		}
+		activReplay = replay
+		replayWindow.Close()
+	})
+
+	replayWindow.SetOnClosed(func() {
+		replayWindowOpen = false
+	})
+
+	replayWindow.SetContent(container.NewVBox(
+		statusLabel,
+		form,
+		helpLabel,
+		container.NewAdaptiveGrid(2, clearButton, okButton),
+	))
+	replayWindow.Resize(fyne.NewSize(600, 300))
+	replayWindow.Show()
+}
+
+func parseReplayForm(path, target, speed string) (*core.ReplayConfig, error) {
+	replay := &core.ReplayConfig{Path: strings.TrimSpace(path)}
+	if replay.Path == "" {
+		return nil, errors.New("choose an access log")
+	}
+	if _, err := os.Stat(replay.Path); err != nil {
+		return nil, err
+	}
+
+	if target = strings.TrimSpace(target); target != "" {
+		protocol := core.HTTP
+		validated, err := core.ValidateURL(target, &protocol)
+		if err != nil {
+			return nil, fmt.Errorf("target: %w", err)
+		}
+		replay.Target = validated
+	}
+
+	var err error
+	replay.Speed, err = strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(speed), "x"), 64)
+	if err != nil || replay.Speed <= 0 || replay.Speed > core.MAX_REPLAY_SPEED {
+		return nil, fmt.Errorf("speed must be a number between 0 and %v", core.MAX_REPLAY_SPEED)
+	}
+	return replay, nil
+}
@@ -2,7 +2,12 @@ package app
 
 import (
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -16,9 +21,11 @@ const (
 )
 
 var (
-	currentReports  []*core.RequestReport
+	currentReport   *core.TestReport
 	countReqs       atomic.Int64
 	countFailedReqs atomic.Int64
+	errorCountsMu   sync.Mutex
+	errorCounts     = make(map[core.ErrorClass]int64)
 )
 
 func showReport() {
@@ -35,22 +42,80 @@ func showReport() {
 		reportWindow.Close()
 	})
 
+	reportWindow.SetContent(createReportContent(currentReport))
+	reportWindow.Resize(fyne.NewSize(800, 600))
+	reportWindow.Show()
+}
+
+func createReportContent(report *core.TestReport) fyne.CanvasObject {
+	if report == nil || len(report.Requests) == 0 {
+		return container.NewVScroll(widget.NewLabel("No reports."))
+	}
+
 	sections := []fyne.CanvasObject{}
 
-	for _, reqsRep := range currentReports {
+	// Keep grouped requests together, in the order their groups first appear.
+	groupOrder := make(map[string]int)
+	for _, reqsRep := range report.Requests {
+		if _, ok := groupOrder[reqsRep.Group]; !ok {
+			groupOrder[reqsRep.Group] = len(groupOrder)
+		}
+	}
+	requests := slices.Clone(report.Requests)
+	sort.SliceStable(requests, func(i, j int) bool {
+		return groupOrder[requests[i].Group] < groupOrder[requests[j].Group]
+	})
+
+	group := ""
+	for _, reqsRep := range requests {
+		if reqsRep.Group != group {
+			group = reqsRep.Group
+			sections = append(sections, widget.NewLabelWithStyle("Group: "+group, fyne.TextAlignLeading, fyne.TextStyle{Bold: true, Italic: true}))
+		}
+
+		title := fmt.Sprintf("URL: %s", reqsRep.Url)
+		if reqsRep.Name != "" {
+			title = fmt.Sprintf("%s, URL: %s", reqsRep.Name, reqsRep.Url)
+		}
 		urlLabel := widget.NewLabelWithStyle(
-			core.TruncateString(fmt.Sprintf("URL: %s", reqsRep.Url), MAX_URL_LEN),
+			core.TruncateString(title, MAX_URL_LEN),
 			fyne.TextAlignLeading,
 			fyne.TextStyle{Bold: true},
 		)
 
 		info := widget.NewLabel(fmt.Sprintf(
-			"Average response time: %d ms\nMaximum response time: %d ms\nMinimal response time: %d ms\nNumber of requests: %d",
+			"Average response time: %d ms\nMaximum response time: %d ms\nMinimal response time: %d ms\nNumber of requests: %d\n"+
+				"Service time p50/p90/p99: %.2f / %.2f / %.2f ms\n"+
+				"Corrected response time avg/p50/p90/p99/max: %.2f / %.2f / %.2f / %.2f / %.2f ms",
 			reqsRep.AvgTime.Milliseconds(),
 			reqsRep.MaxTime.Milliseconds(),
 			reqsRep.MinTime.Milliseconds(),
 			reqsRep.Count,
+			durationMs(reqsRep.LatencyPercentile(50)),
+			durationMs(reqsRep.LatencyPercentile(90)),
+			durationMs(reqsRep.LatencyPercentile(99)),
+			durationMs(reqsRep.AvgResponseTime),
+			durationMs(reqsRep.ResponseTimePercentile(50)),
+			durationMs(reqsRep.ResponseTimePercentile(90)),
+			durationMs(reqsRep.ResponseTimePercentile(99)),
+			durationMs(reqsRep.MaxResponseTime),
 		))
+		if reqsRep.BodySizes.Total > 0 {
+			info.SetText(info.Text + fmt.Sprintf(
+				"\nTraffic sent/received: %s / %s (%s/s / %s/s)\nResponse body size p50/p90/p99/max: %s / %s / %s / %s",
+				formatBytes(float64(reqsRep.BytesSent)),
+				formatBytes(float64(reqsRep.BytesReceived)),
+				formatBytes(reqsRep.SentPerSecond()),
+				formatBytes(reqsRep.ReceivedPerSecond()),
+				formatBytes(float64(reqsRep.BodySizes.Percentile(50))),
+				formatBytes(float64(reqsRep.BodySizes.Percentile(90))),
+				formatBytes(float64(reqsRep.BodySizes.Percentile(99))),
+				formatBytes(float64(reqsRep.BodySizes.Max)),
+			))
+		}
+		if reqsRep.LateRequests > 0 {
+			info.SetText(info.Text + fmt.Sprintf("\nLate requests: %d (max lag %.2f ms)", reqsRep.LateRequests, durationMs(reqsRep.MaxLag)))
+		}
 
 		reqCodes := widget.NewLabel("Request codes and frequencies:")
 		reqCodeContent := ""
@@ -64,32 +129,196 @@ func showReport() {
 		if len(reqsRep.Errors) == 0 {
 			errorsContent = "No errors.\n"
 		} else {
-			for err, count := range reqsRep.Errors {
-				wrappedError := core.WrapText(fmt.Sprintf("  - %s: %d", err, count), MAX_ROW_LEN)
-				fmt.Println("wrappedError", wrappedError)
-				errorsContent += wrappedError + "\n"
-			}
+			errorsContent = formatErrorSummaries(reqsRep.ErrorCategories())
 		}
 		errorsContentLabel := widget.NewLabel(errorsContent)
 
-		sections = append(sections, container.NewVBox(
-			urlLabel,
+		section := container.NewVBox(urlLabel)
+		if len(reqsRep.Tags) > 0 {
+			section.Add(widget.NewLabel("Tags: " + strings.Join(reqsRep.Tags, ", ")))
+		}
+		section.Objects = append(section.Objects,
 			info,
 			reqCodes,
 			reqCodesContent,
 			errorsLabel,
 			errorsContentLabel,
-			widget.NewSeparator(),
-		))
+		)
+
+		if phases := reqsRep.Phases; phases.NewConns+phases.ReusedConns > 0 {
+			section.Add(widget.NewLabelWithStyle("Connection phases (average):", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}))
+			section.Add(widget.NewLabel(fmt.Sprintf(
+				"  - DNS lookup: %.2f ms\n  - TCP connect: %.2f ms\n  - TLS handshake: %.2f ms\n  - Time to first byte: %.2f ms\n  - Content transfer: %.2f ms\n  - New connections: %d, Reused connections: %d",
+				durationMs(phases.AvgDNS),
+				durationMs(phases.AvgConnect),
+				durationMs(phases.AvgTLS),
+				durationMs(phases.AvgTTFB),
+				durationMs(phases.AvgTransfer),
+				phases.NewConns,
+				phases.ReusedConns,
+			)))
+		}
+
+		if len(reqsRep.ProxyErrors) > 0 {
+			proxyErrorsContent := ""
+			for proxy, count := range reqsRep.ProxyErrors {
+				proxyErrorsContent += core.WrapText(fmt.Sprintf("  - %s: %d", proxy, count), MAX_ROW_LEN) + "\n"
+			}
+			section.Add(widget.NewLabelWithStyle("Errors by proxy:", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}))
+			section.Add(widget.NewLabel(proxyErrorsContent))
+		}
+
+		section.Add(widget.NewSeparator())
+		sections = append(sections, section)
 	}
 
-	reportContent := container.NewVScroll(container.NewVBox(sections...))
+	if tagReports := report.TagReports(); len(tagReports) > 0 {
+		sections = append(sections, widget.NewLabelWithStyle("By tag", fyne.TextAlignLeading, fyne.TextStyle{Bold: true, Italic: true}))
+		for _, tagRep := range tagReports {
+			sections = append(sections,
+				widget.NewLabelWithStyle("Tag: "+tagRep.Name, fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+				widget.NewLabel(fmt.Sprintf(
+					"Number of requests: %d (%.2f req/s)\nErrors: %d (%.2f%%)\n"+
+						"Service time avg/p50/p90/p99: %.2f / %.2f / %.2f / %.2f ms\n"+
+						"Corrected response time p50/p90/p99/max: %.2f / %.2f / %.2f / %.2f ms",
+					tagRep.Count,
+					tagRep.RequestsPerSecond(),
+					tagRep.ErrorCount(),
+					tagRep.ErrorRate()*100,
+					durationMs(tagRep.AvgTime),
+					durationMs(tagRep.LatencyPercentile(50)),
+					durationMs(tagRep.LatencyPercentile(90)),
+					durationMs(tagRep.LatencyPercentile(99)),
+					durationMs(tagRep.ResponseTimePercentile(50)),
+					durationMs(tagRep.ResponseTimePercentile(90)),
+					durationMs(tagRep.ResponseTimePercentile(99)),
+					durationMs(tagRep.MaxResponseTime),
+				)),
+				widget.NewSeparator(),
+			)
+		}
+	}
 
-	if len(currentReports) == 0 {
-		reportContent = container.NewVScroll(widget.NewLabel("No reports."))
+	lateRequests := 0
+	var maxLag time.Duration
+	for _, reqsRep := range report.Requests {
+		lateRequests += reqsRep.LateRequests
+		maxLag = max(maxLag, reqsRep.MaxLag)
+	}
+	if lateRequests > 0 {
+		warning := widget.NewLabelWithStyle(
+			fmt.Sprintf("Warning: the generator fell behind schedule, %d requests were sent late (max lag %.2f ms).\n"+
+				"Corrected response times include this delay, service times don't.", lateRequests, durationMs(maxLag)),
+			fyne.TextAlignLeading,
+			fyne.TextStyle{Bold: true},
+		)
+		sections = append([]fyne.CanvasObject{warning, widget.NewSeparator()}, sections...)
 	}
 
-	reportWindow.SetContent(reportContent)
-	reportWindow.Resize(fyne.NewSize(800, 600))
-	reportWindow.Show()
+	if len(report.Metrics) > 0 {
+		metrics := widget.NewLabelWithStyle("Script metrics", fyne.TextAlignLeading, fyne.TextStyle{Bold: true, Italic: true})
+		grid := container.NewGridWithColumns(5,
+			widget.NewLabelWithStyle("Metric", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+			widget.NewLabelWithStyle("Count", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+			widget.NewLabelWithStyle("Mean", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+			widget.NewLabelWithStyle("Min", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+			widget.NewLabelWithStyle("Max", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		)
+		for _, name := range report.MetricNames() {
+			metric := report.Metrics[name]
+			grid.Add(widget.NewLabel(core.TruncateString(name, MAX_URL_LEN/2)))
+			grid.Add(widget.NewLabel(fmt.Sprintf("%d", metric.Count)))
+			grid.Add(widget.NewLabel(fmt.Sprintf("%.2f", metric.Mean())))
+			grid.Add(widget.NewLabel(fmt.Sprintf("%.2f", metric.Min)))
+			grid.Add(widget.NewLabel(fmt.Sprintf("%.2f", metric.Max)))
+		}
+		sections = append(sections, metrics, grid, widget.NewSeparator())
+	}
+
+	if len(report.Events) > 1 {
+		changes := "Load changes during the test:"
+		for _, event := range report.Events {
+			changes += fmt.Sprintf("\n  - %s: %d clients, delay %v (%.2f req/s)",
+				formatOffset(event.Time), event.Workers, event.Delay, event.RequestsPerSecond())
+		}
+		sections = append([]fyne.CanvasObject{widget.NewLabel(changes), widget.NewSeparator()}, sections...)
+	}
+
+	if replay := report.Replay; replay != nil {
+		summary := fmt.Sprintf("Replayed %d requests of %s spanning %s at %gx speed", replay.Entries, replay.Path, replay.Span.Round(time.Second), replay.Speed)
+		if replay.Target != "" {
+			summary += " against " + replay.Target
+		}
+		if replay.Skipped > 0 {
+			summary += fmt.Sprintf(", %d lines of the log were skipped", replay.Skipped)
+		}
+		summary += ". Requests are grouped by the status they originally got."
+		if replay.Err != "" {
+			summary += " The replay stopped early: " + replay.Err
+		}
+		replayLabel := widget.NewLabel(summary)
+		replayLabel.Wrapping = fyne.TextWrapWord
+		sections = append([]fyne.CanvasObject{replayLabel, widget.NewSeparator()}, sections...)
+	}
+
+	if report.ResultLog != "" {
+		resultLog := widget.NewLabel("Every result was written to " + report.ResultLog)
+		if report.ResultLogErr != "" {
+			resultLog.SetText(fmt.Sprintf("The result log %s is incomplete: %s", report.ResultLog, report.ResultLogErr))
+		}
+		resultLog.Wrapping = fyne.TextWrapWord
+		sections = append([]fyne.CanvasObject{resultLog, widget.NewSeparator()}, sections...)
+	}
+
+	if report.Dropped > 0 {
+		dropped := widget.NewLabel(fmt.Sprintf("%d results were not shown in the live output because it could not keep up, they are counted in this report.", report.Dropped))
+		sections = append([]fyne.CanvasObject{dropped, widget.NewSeparator()}, sections...)
+	}
+
+	if report.Paused > 0 {
+		paused := widget.NewLabel(fmt.Sprintf("The test was paused for %s, pauses are not counted in the test duration.", report.Paused.Round(time.Second)))
+		sections = append([]fyne.CanvasObject{paused, widget.NewSeparator()}, sections...)
+	}
+
+	if totals := report.ErrorTotals(); len(totals) > 0 {
+		summary := "Errors by category:"
+		for _, total := range totals {
+			summary += fmt.Sprintf("\n  - %s: %d", total.Class(), total.Count)
+		}
+		sections = append([]fyne.CanvasObject{widget.NewLabel(summary), widget.NewSeparator()}, sections...)
+	}
+
+	return container.NewVScroll(container.NewVBox(sections...))
+}
+
+func formatOffset(offset time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(offset.Minutes()), int(offset.Seconds())%60)
+}
+
+func formatErrorSummaries(summaries []*core.ErrorSummary) string {
+	content := ""
+	for _, summary := range summaries {
+		content += fmt.Sprintf("  - %s: %d\n", summary.Class(), summary.Count)
+		if summary.Sample != "" {
+			content += core.WrapText("      e.g. "+summary.Sample, MAX_ROW_LEN) + "\n"
+		}
+	}
+	return content
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func formatBytes(b float64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	unit := 0
+	for b >= 1024 && unit < len(units)-1 {
+		b /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%.0f %s", b, units[unit])
+	}
+	return fmt.Sprintf("%.2f %s", b, units[unit])
 }
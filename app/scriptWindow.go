@@ -0,0 +1,109 @@
+package app
+
+import (
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/prorok210/TestYourServer/core"
+)
+
+const (
+	SCRIPT_TEMPLATE = `// Every client runs its own copy of this script, all functions are optional.
+// http.request(method, url, {headers, body, name, tags}), http.get, http.post
+// and ws.send(payload) send requests, vars.get/vars.set share copies of JSON
+// values between clients, metric(name, value) records a custom metric,
+// sleep(ms) and log(...).
+
+function setup() {
+  // Runs once per client before the first request, e.g. to log in.
+}
+
+function beforeRequest(req) {
+  // Runs before each configured request. Change req.url, req.headers or
+  // req.body, or return false to skip the request.
+}
+
+function afterResponse(req, res) {
+  // Runs after each configured request with res.status, res.body,
+  // res.headers, res.time in ms and res.error.
+}
+
+function teardown() {
+  // Runs once per client after the test.
+}
+
+// Define iteration() to send the requests yourself instead of the configured
+// ones, it runs on every tick of the request delay.
+`
+)
+
+var (
+	scriptButton     *widget.Button
+	scriptWindowOpen bool
+	scriptSource     string
+	activScript      *core.Script
+)
+
+func showScriptWindow() {
+	if scriptWindowOpen {
+		return
+	}
+	scriptWindowOpen = true
+
+	scriptWindow := fyne.CurrentApp().NewWindow("Script")
+
+	sourceEntry := widget.NewMultiLineEntry()
+	sourceEntry.TextStyle = fyne.TextStyle{Monospace: true}
+	sourceEntry.SetText(scriptSource)
+	if scriptSource == "" {
+		sourceEntry.SetText(SCRIPT_TEMPLATE)
+	}
+
+	statusLabel := widget.NewLabel("No script, requests are sent as configured.")
+	if activScript != nil {
+		statusLabel.SetText("Script active.")
+	}
+
+	clearButton := widget.NewButton("Remove script", func() {
+		scriptSource = ""
+		activScript = nil
+		scriptWindow.Close()
+	})
+
+	okButton := widget.NewButton("OK", func() {
+		source := sourceEntry.Text
+		if strings.TrimSpace(source) == "" {
+			scriptSource = ""
+			activScript = nil
+			scriptWindow.Close()
+			return
+		}
+
+		script, err := core.CompileScript(source)
+		if err != nil {
+			dialog.ShowInformation("Error", core.WrapText(err.Error(), MAX_ROW_LEN), scriptWindow)
+			return
+		}
+
+		scriptSource = source
+		activScript = script
+		scriptWindow.Close()
+	})
+
+	scriptWindow.SetOnClosed(func() {
+		scriptWindowOpen = false
+	})
+
+	scriptWindow.SetContent(container.NewBorder(
+		statusLabel,
+		container.NewAdaptiveGrid(2, clearButton, okButton),
+		nil,
+		nil,
+		sourceEntry,
+	))
+	scriptWindow.Resize(fyne.NewSize(800, 600))
+	scriptWindow.Show()
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/prorok210/TestYourServer/core"
+)
+
+const (
+	UPDATE_TARGET_STATS_DELAY = time.Second
+)
+
+var (
+	targetButton     *widget.Button
+	targetWindowOpen bool
+	targetServer     *core.TargetServer
+	targetConfig     = core.TargetConfig{Addr: core.DEFAULT_TARGET_ADDR, PushInterval: core.DEFAULT_TARGET_PUSH_INTERVAL}
+)
+
+func showTargetWindow() {
+	if targetWindowOpen {
+		return
+	}
+	targetWindowOpen = true
+
+	targetWindow := fyne.CurrentApp().NewWindow("Target server")
+
+	addrEntry := widget.NewEntry()
+	addrEntry.SetText(targetConfig.Addr)
+
+	delayEntry := widget.NewEntry()
+	delayEntry.SetText(strconv.FormatInt(targetConfig.Delay.Milliseconds(), 10))
+
+	failEntry := widget.NewEntry()
+	failEntry.SetText(strconv.FormatFloat(targetConfig.FailureRate*100, 'f', -1, 64))
+
+	pushEntry := widget.NewEntry()
+	pushEntry.SetText(strconv.FormatInt(targetConfig.PushInterval.Milliseconds(), 10))
+
+	form := widget.NewForm(
+		widget.NewFormItem("Address", addrEntry),
+		widget.NewFormItem("Response delay, ms", delayEntry),
+		widget.NewFormItem("Random failures, %", failEntry),
+		widget.NewFormItem("WebSocket push interval, ms", pushEntry),
+	)
+
+	statusLabel := widget.NewLabel("")
+	helpLabel := widget.NewLabel(core.TARGET_HELP)
+
+	var startButton, copyButton *widget.Button
+
+	update := func() {
+		if targetServer == nil {
+			statusLabel.SetText("Stopped.")
+			startButton.SetText("Start")
+			copyButton.Disable()
+			form.Enable()
+			return
+		}
+		statusLabel.SetText(fmt.Sprintf("Running at %s and %s\nRequests received: %d",
+			targetServer.URL(), targetServer.WSURL(), targetServer.Requests()))
+		startButton.SetText("Stop")
+		copyButton.Enable()
+		form.Disable()
+	}
+
+	startButton = widget.NewButton("Start", func() {
+		if targetServer != nil {
+			if err := targetServer.Close(); err != nil {
+				fmt.Println("failed to stop the target server:", err)
+			}
+			targetServer = nil
+			update()
+			return
+		}
+
+		config, err := parseTargetForm(addrEntry.Text, delayEntry.Text, failEntry.Text, pushEntry.Text)
+		if err != nil {
+			dialog.ShowInformation("Error", err.Error(), targetWindow)
+			return
+		}
+
+		server, err := core.StartTarget(config)
+		if err != nil {
+			dialog.ShowInformation("Error", err.Error(), targetWindow)
+			return
+		}
+		targetConfig = config
+		targetServer = server
+		update()
+	})
+
+	copyButton = widget.NewButton("Copy echo URL", func() {
+		if targetServer != nil {
+			targetWindow.Clipboard().SetContent(targetServer.URL() + "/echo")
+		}
+	})
+
+	update()
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(UPDATE_TARGET_STATS_DELAY)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if targetServer != nil {
+					update()
+				}
+			}
+		}
+	}()
+
+	targetWindow.SetOnClosed(func() {
+		close(done)
+		targetWindowOpen = false
+	})
+
+	targetWindow.SetContent(container.NewBorder(
+		container.NewVBox(form, statusLabel, container.NewAdaptiveGrid(2, startButton, copyButton), widget.NewSeparator()),
+		nil,
+		nil,
+		nil,
+		container.NewVScroll(helpLabel),
+	))
+	targetWindow.Resize(fyne.NewSize(600, 600))
+	targetWindow.Show()
+}
+
+func parseTargetForm(addr, delay, fail, push string) (core.TargetConfig, error) {
+	config := core.TargetConfig{Addr: strings.TrimSpace(addr)}
+
+	delayMs, err := strconv.ParseFloat(strings.TrimSpace(delay), 64)
+	if err != nil {
+		return config, errors.New("response delay must be a number of milliseconds")
+	}
+	failPercent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(fail), "%"), 64)
+	if err != nil {
+		return config, errors.New("random failures must be a percentage")
+	}
+	pushMs, err := strconv.ParseFloat(strings.TrimSpace(push), 64)
+	if err != nil || pushMs <= 0 {
+		return config, errors.New("push interval must be a positive number of milliseconds")
+	}
+
+	config.Delay = time.Duration(delayMs * float64(time.Millisecond))
+	config.FailureRate = failPercent / 100
+	config.PushInterval = time.Duration(pushMs * float64(time.Millisecond))
+
+	return config, core.ValidateTargetConfig(&config)
+}
@@ -3,6 +3,9 @@ package app
 import (
 	"context"
 	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -18,44 +21,74 @@ const (
 	MAX_BODY_LEN           = 1000
 	MAX_ENTRY_LEN          = 2000
 	MAX_HEADERS            = 10
+	// Error categories listed under the stats
+	MAX_STATS_ERROR_CATEGORIES = 4
 )
 
 func startTesting() {
-	delaySlider.Disable()
 	durationSlider.Disable()
-	delayEntry.Disable()
 	durationEntry.Disable()
-	workersEntry.Disable()
-	workersSlider.Disable()
 	reportButton.Disable()
+	historyButton.Disable()
 	configRequestsButton.Disable()
 	protocolButton.Disable()
+	authButton.Disable()
+	scriptButton.Disable()
+	replayButton.Disable()
+	discardBody.Disable()
+	writeResultLog.Disable()
+	resultLogFormat.Disable()
+	// A replay keeps the load of the log, it can't be changed live.
+	if activReplay != nil {
+		delaySlider.Disable()
+		delayEntry.Disable()
+		workersSlider.Disable()
+		workersEntry.Disable()
+		rateEntry.Disable()
+	}
 
-	testCtx, testCancel = context.WithTimeout(context.Background(), time.Duration(durationSlider.Value)*time.Minute)
+	testCtx, testCancel = context.WithCancel(context.Background())
 	displayCtx, displayCtxCancel = context.WithCancel(context.Background())
+	testControl = core.NewTestControl()
+	pauseButton.SetText("Pause")
+	pauseButton.Enable()
 	countReqs.Store(0)
 	countFailedReqs.Store(0)
-	go startTimer(time.Duration(durationSlider.Value) * time.Minute)
+	errorCountsMu.Lock()
+	clear(errorCounts)
+	errorCountsMu.Unlock()
+	go startTimer(time.Duration(durationSlider.Value * float64(time.Minute)))
 }
 
 func endTesting() {
 	testCancel()
 	<-displayCtx.Done()
 
-	testCtx, testCancel = context.WithTimeout(context.Background(), time.Duration(durationSlider.Value)*time.Minute)
+	testCtx, testCancel = context.WithCancel(context.Background())
 	displayCtx, displayCtxCancel = context.WithCancel(context.Background())
 	testButton.SetText("Start testing")
+	pauseButton.SetText("Pause")
+	pauseButton.Disable()
 	testIsActiv = false
 
-	delaySlider.Enable()
+	updateDelayInputs()
 	durationSlider.Enable()
-	delayEntry.Enable()
 	durationEntry.Enable()
 	workersEntry.Enable()
 	workersSlider.Enable()
+	rateEntry.Enable()
 	reportButton.Enable()
+	historyButton.Enable()
 	configRequestsButton.Enable()
 	protocolButton.Enable()
+	authButton.Enable()
+	scriptButton.Enable()
+	replayButton.Enable()
+	discardBody.Enable()
+	writeResultLog.Enable()
+	if writeResultLog.Checked {
+		resultLogFormat.Enable()
+	}
 }
 
 func testButtonFunc() {
@@ -69,7 +102,28 @@ func testButtonFunc() {
 		return
 	}
 
-	if len(activRequsts) == 0 {
+	if authWindowOpen {
+		dialog.ShowInformation("Error", "Can't start testing while the authentication window is open", window)
+		return
+	}
+
+	if scriptWindowOpen {
+		dialog.ShowInformation("Error", "Can't start testing while the script window is open", window)
+		return
+	}
+
+	if replayWindowOpen {
+		dialog.ShowInformation("Error", "Can't start testing while the replay window is open", window)
+		return
+	}
+
+	if activReplay != nil && activScript != nil {
+		dialog.ShowInformation("Error", "A script can't be combined with a replay, remove one of them", window)
+		return
+	}
+
+	scripted := activScript != nil && activScript.HasIteration() && selectedProtocol == core.HTTP
+	if len(activRequsts) == 0 && !scripted && activReplay == nil {
 		dialog.ShowInformation("Error", "Configure requests before starting the test", window)
 		return
 	}
@@ -77,22 +131,46 @@ func testButtonFunc() {
 	if testIsActiv {
 		testCancel()
 	} else {
+		seed, _ := core.ParseCookies(cookieSeed)
+
 		startTesting()
 		reqSetting := &core.RequestsConfig{
 			Requests:            activRequsts,
+			Scenario:            activScenario,
 			Count_Workers:       int(workersSlider.Value),
-			Delay:               time.Duration(delaySlider.Value) * time.Millisecond,
-			Duration:            time.Duration(durationSlider.Value) * time.Second,
+			Delay:               testDelay(),
+			Duration:            time.Duration(durationSlider.Value * float64(time.Minute)),
 			RequestChanBufSize:  100,
 			ResponseChanBufSize: 100,
 			Secure:              disableCheckTls,
 			Protocol:            selectedProtocol,
+			Proxy: &core.ProxyConfig{
+				URLs:     strings.Split(proxyList, "\n"),
+				Rotation: proxyRotation,
+			},
+			Auth: authConfig,
+			Cookies: &core.CookieConfig{
+				Enabled:           cookiesEnabled,
+				ResetPerIteration: cookiesReset,
+				Seed:              seed,
+			},
+			TLS:         tlsSettings,
+			DiscardBody: discardBody.Checked,
+			Control:     testControl,
+			Script:      activScript,
+			ResultLog:   resultLogPath(),
+		}
+		if activReplay != nil {
+			replay := *activReplay
+			reqSetting.Replay = &replay
+			reqSetting.Requests, reqSetting.Scenario = nil, nil
 		}
 
 		outChan := make(chan *core.RequestInfo, OUT_REQ_CHAN_BUF)
 
 		go func() {
-			currentReports = core.StartSendingRequests(outChan, reqSetting, testCtx)
+			currentReport = core.StartSendingRequests(outChan, reqSetting, testCtx)
+			saveToHistory(currentReport)
 			displayCtxCancel()
 		}()
 
@@ -111,15 +189,20 @@ func testButtonFunc() {
 			processResp := func(resp *core.RequestInfo) {
 				batchText.Reset()
 
+				if resp.Err != nil && resp.Request == nil {
+					dialog.ShowInformation("Error", resp.Err.Error(), window)
+					return
+				}
+
 				countReqs.Add(1)
 
 				if resp.Err != nil {
-					if resp.Err.Error() == "No requests" {
-						dialog.ShowInformation("Error", "No requests", window)
-						return
-					}
 					countFailedReqs.Add(1)
-					batchText.WriteString(fmt.Sprintf("Error: %v\n", core.TruncateString(resp.Err.Error(), MAX_ROW_LEN)))
+					class := core.ClassifyError(resp.Err)
+					errorCountsMu.Lock()
+					errorCounts[class]++
+					errorCountsMu.Unlock()
+					batchText.WriteString(fmt.Sprintf("Error [%s]: %v\n", class, core.TruncateString(resp.Err.Error(), MAX_ROW_LEN)))
 				}
 
 				if showRequest.Checked {
@@ -134,6 +217,10 @@ func testButtonFunc() {
 					fmt.Fprintf(&batchText, "Time: %v\n", resp.Time)
 				}
 
+				if showCookies.Checked {
+					fmt.Fprintf(&batchText, "Cookies: %d\n", resp.Cookies)
+				}
+
 				if resp.Response != nil {
 					fmt.Fprintf(&batchText, "Status: %d\n", resp.Response.Status)
 					if showBody.Checked && resp.Response.Body != nil {
@@ -218,24 +305,85 @@ func testButtonFunc() {
 	}
 }
 
+func pauseButtonFunc() {
+	if !testIsActiv {
+		return
+	}
+
+	if testControl.Paused() {
+		testControl.Resume()
+		pauseButton.SetText("Pause")
+	} else {
+		testControl.Pause()
+		pauseButton.SetText("Resume")
+	}
+}
+
+// applyLiveLoad passes the delay and workers sliders to the running test.
+func applyLiveLoad() {
+	if !testIsActiv || testControl == nil {
+		return
+	}
+
+	if err := testControl.SetWorkers(int(workersSlider.Value)); err != nil {
+		fmt.Println("failed to change the count of clients:", err)
+	}
+	if rate, ok := targetRate(); ok {
+		if err := testControl.SetRate(rate); err != nil {
+			fmt.Println("failed to change the target rate:", err)
+		}
+	} else if err := testControl.SetDelay(time.Duration(delaySlider.Value) * time.Millisecond); err != nil {
+		fmt.Println("failed to change the request delay:", err)
+	}
+}
+
+// targetRate is the rate entry when it holds a positive number.
+func targetRate() (float64, bool) {
+	rate, err := strconv.ParseFloat(strings.TrimSpace(rateEntry.Text), 64)
+	return rate, err == nil && rate > 0
+}
+
+// testDelay is the delay of each client, from the target rate when it's set.
+func testDelay() time.Duration {
+	if rate, ok := targetRate(); ok {
+		return core.RateDelay(int(workersSlider.Value), rate)
+	}
+	return time.Duration(delaySlider.Value) * time.Millisecond
+}
+
+// updateDelayInputs disables the delay while a target rate replaces it.
+func updateDelayInputs() {
+	if _, ok := targetRate(); ok {
+		delaySlider.Disable()
+		delayEntry.Disable()
+	} else {
+		delaySlider.Enable()
+		delayEntry.Enable()
+	}
+}
+
 func startTimer(maxDuration time.Duration) {
-	elapsed := time.Duration(0)
+	control := testControl
 	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop()
-	var remainingMinutes, remainingSeconds, elapsedMinutes, elapsedSeconds int
 
 	updateStats := func() {
-		elapsed += time.Second
-		remaining := maxDuration - elapsed
-		if remaining <= 0 {
-			return
+		elapsed := control.Elapsed()
+		remaining := max(maxDuration-elapsed, 0)
+		status := ""
+		if control.Paused() {
+			status = " (paused)"
+		}
+		// Requests the live output had no room for are still sent, only the
+		// failures among them aren't known until the report.
+		dropped := control.Dropped()
+		droppedText := ""
+		if dropped > 0 {
+			droppedText = fmt.Sprintf("\nNot shown live: %d", dropped)
 		}
-		remainingMinutes = int(remaining.Minutes())
-		remainingSeconds = int(remaining.Seconds()) % 60
-		elapsedMinutes = int(elapsed.Minutes())
-		elapsedSeconds = int(elapsed.Seconds()) % 60
-		StatsLabel.SetText(fmt.Sprintf("Time left: %02d:%02d\nTime elapsed: %02d:%02d\nRequests sent: %d\nRequests failed: %d",
-			remainingMinutes, remainingSeconds, elapsedMinutes, elapsedSeconds, countReqs.Load(), countFailedReqs.Load()))
+		StatsLabel.SetText(fmt.Sprintf("Time left: %02d:%02d%s\nTime elapsed: %02d:%02d\nClients: %d, delay: %v\nRequests sent: %d\nRequests failed: %d%s",
+			int(remaining.Minutes()), int(remaining.Seconds())%60, status, int(elapsed.Minutes()), int(elapsed.Seconds())%60,
+			control.Workers(), control.Delay(), countReqs.Load()+dropped, countFailedReqs.Load(), droppedText) + errorCountsText())
 	}
 
 	for {
@@ -249,3 +397,50 @@ func startTimer(maxDuration time.Duration) {
 		}
 	}
 }
+
+// errorCountsText lists the most frequent error categories for the stats label.
+func errorCountsText() string {
+	errorCountsMu.Lock()
+	classes := make([]core.ErrorClass, 0, len(errorCounts))
+	counts := make(map[core.ErrorClass]int64, len(errorCounts))
+	for class, count := range errorCounts {
+		classes = append(classes, class)
+		counts[class] = count
+	}
+	errorCountsMu.Unlock()
+
+	sort.Slice(classes, func(i, j int) bool {
+		if counts[classes[i]] != counts[classes[j]] {
+			return counts[classes[i]] > counts[classes[j]]
+		}
+		return classes[i].String() < classes[j].String()
+	})
+
+	text := ""
+	for i, class := range classes {
+		if i == MAX_STATS_ERROR_CATEGORIES {
+			text += fmt.Sprintf("\n  ...and %d more", len(classes)-i)
+			break
+		}
+		text += fmt.Sprintf("\n  %s: %d", class, counts[class])
+	}
+	return text
+}
+
+// resultLogPath names the log of a new test, empty when no log is written.
+func resultLogPath() string {
+	if !writeResultLog.Checked {
+		return ""
+	}
+
+	dir, err := core.DefaultResultLogDir()
+	if err != nil {
+		fmt.Println("failed to find the result log directory:", err)
+		return ""
+	}
+	ext := ".jsonl.gz"
+	if resultLogFormat.Selected == core.RESULT_LOG_CSV.String() {
+		ext = ".csv.gz"
+	}
+	return filepath.Join(dir, "results-"+core.NewRunID(time.Now())+ext)
+}
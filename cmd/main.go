@@ -1,9 +1,77 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
 	"github.com/prorok210/TestYourServer/app"
+	"github.com/prorok210/TestYourServer/core"
 )
 
 func main() {
+	target := flag.Bool("target", false, "run only the built-in target server, without the GUI")
+	targetAddr := flag.String("target-addr", core.DEFAULT_TARGET_ADDR, "address of the target server")
+	targetDelay := flag.Duration("target-delay", 0, "delay of every target response")
+	targetFail := flag.Float64("target-fail", 0, "share of target requests answered with 500, 0 to 1")
+	targetPush := flag.Duration("target-push", core.DEFAULT_TARGET_PUSH_INTERVAL, "message interval of the WebSocket push endpoint")
+	record := flag.Bool("record", false, "run only the recording proxy, without the GUI")
+	recordAddr := flag.String("record-addr", core.DEFAULT_RECORDER_ADDR, "address of the recording proxy")
+	recordTarget := flag.String("record-target", "", "send the recorded requests to this URL instead of acting as a proxy")
+	recordOut := flag.String("record-out", "recording.har", "HAR file the recorded requests are saved to")
+	flag.Parse()
+
+	if *target {
+		server, err := core.StartTarget(core.TargetConfig{
+			Addr:         *targetAddr,
+			Delay:        *targetDelay,
+			FailureRate:  *targetFail,
+			PushInterval: *targetPush,
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Target server listening on %s and %s, see %s/ for the endpoints\n", server.URL(), server.WSURL(), server.URL())
+
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt)
+		<-stop
+
+		fmt.Printf("Stopping, %d requests received\n", server.Requests())
+		server.Close()
+		return
+	}
+
+	if *record {
+		recorder, err := core.StartRecorder(core.RecorderConfig{Addr: *recordAddr, Target: *recordTarget})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Recording at %s, press Ctrl+C to save the requests to %s\n", recorder.URL(), *recordOut)
+
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt)
+		<-stop
+		recorder.Close()
+
+		file, err := os.Create(*recordOut)
+		if err == nil {
+			err = core.WriteHAR(file, recorder.Records())
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		recorded, _ := recorder.Count()
+		fmt.Printf("Saved %d requests to %s, import them with Import HAR\n", recorded, *recordOut)
+		return
+	}
+
 	app.CreateAppWindow()
 }
@@ -0,0 +1,261 @@
+package core
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CLF_TIME_LAYOUT        = "02/Jan/2006:15:04:05 -0700"
+	MAX_ACCESS_LOG_LINE    = 1 << 20
+	MAX_ACCESS_LOG_SKIPPED = 5
+)
+
+// clfLine matches the Common Log Format, the referer and user agent of the
+// Combined Log Format are optional.
+var clfLine = regexp.MustCompile(`^(\S+) \S+ (\S+) \[([^\]]+)\] "(\S+) (\S+)(?: [^"]*)?" (\d{3}) (\d+|-)(?: "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)")?`)
+
+// AccessLogEntry is one request of an access log. URL is the request target
+// as logged, a path or an absolute URL.
+type AccessLogEntry struct {
+	Time      time.Time
+	Method    string
+	URL       string
+	Host      string
+	Status    int
+	Size      int64
+	Referer   string
+	UserAgent string
+	Headers   map[string]string
+	Body      string
+}
+
+// AccessLogReader reads Common/Combined Log Format or JSON Lines access
+// logs, the format is detected per line. Lines it can't parse are skipped
+// and counted.
+type AccessLogReader struct {
+	scanner *bufio.Scanner
+	closer  io.Closer
+	line    int
+	skipped int
+	// samples are the first skipped lines with the reason.
+	samples []string
+}
+
+// OpenAccessLog opens an access log, gzip when the name ends with .gz.
+func OpenAccessLog(path string) (*AccessLogReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var in io.Reader = file
+	if strings.HasSuffix(strings.ToLower(path), ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		in = gz
+	}
+
+	r := NewAccessLogReader(in)
+	r.closer = file
+	return r, nil
+}
+
+func NewAccessLogReader(in io.Reader) *AccessLogReader {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64<<10), MAX_ACCESS_LOG_LINE)
+	return &AccessLogReader{scanner: scanner}
+}
+
+// Next returns the next entry, io.EOF after the last one.
+func (r *AccessLogReader) Next() (*AccessLogEntry, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := strings.TrimSpace(r.scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var entry *AccessLogEntry
+		var err error
+		if strings.HasPrefix(line, "{") {
+			entry, err = parseJSONAccessLine(line)
+		} else {
+			entry, err = parseCLFLine(line)
+		}
+		if err != nil {
+			r.skipped++
+			if len(r.samples) < MAX_ACCESS_LOG_SKIPPED {
+				r.samples = append(r.samples, fmt.Sprintf("line %d: %v", r.line, err))
+			}
+			continue
+		}
+		return entry, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("line %d: %w", r.line+1, err)
+	}
+	return nil, io.EOF
+}
+
+// Skipped is the count of lines that couldn't be parsed, with the reasons of
+// the first ones.
+func (r *AccessLogReader) Skipped() (int, []string) {
+	return r.skipped, r.samples
+}
+
+func (r *AccessLogReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+func parseCLFLine(line string) (*AccessLogEntry, error) {
+	match := clfLine.FindStringSubmatch(line)
+	if match == nil {
+		return nil, errors.New("not a Common or Combined Log Format line")
+	}
+
+	t, err := time.Parse(CLF_TIME_LAYOUT, match[3])
+	if err != nil {
+		return nil, err
+	}
+	status, _ := strconv.Atoi(match[6])
+	size, _ := strconv.ParseInt(match[7], 10, 64)
+
+	entry := &AccessLogEntry{
+		Time:   t,
+		Method: match[4],
+		URL:    match[5],
+		Status: status,
+		Size:   size,
+	}
+	if match[8] != "-" {
+		entry.Referer = unescapeCLF(match[8])
+	}
+	if match[9] != "-" {
+		entry.UserAgent = unescapeCLF(match[9])
+	}
+	return entry, nil
+}
+
+func unescapeCLF(value string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(value, `\"`, `"`), `\\`, `\`)
+}
+
+// jsonAccessLine accepts the field names of common JSON access logs, like
+// nginx with escape=json, Caddy and most log shippers.
+type jsonAccessLine struct {
+	Time       json.RawMessage   `json:"time"`
+	Timestamp  json.RawMessage   `json:"timestamp"`
+	Ts         json.RawMessage   `json:"ts"`
+	Method     string            `json:"method"`
+	URL        string            `json:"url"`
+	URI        string            `json:"uri"`
+	Path       string            `json:"path"`
+	RequestURI string            `json:"request_uri"`
+	Request    string            `json:"request"`
+	Host       string            `json:"host"`
+	Status     int               `json:"status"`
+	Size       int64             `json:"size"`
+	Bytes      int64             `json:"bytes"`
+	Referer    string            `json:"referer"`
+	UserAgent  string            `json:"user_agent"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body"`
+}
+
+func parseJSONAccessLine(line string) (*AccessLogEntry, error) {
+	var raw jsonAccessLine
+	if err := json.Unmarshal([]byte(line), &raw); err != nil {
+		return nil, err
+	}
+
+	entry := &AccessLogEntry{
+		Method:    raw.Method,
+		Host:      raw.Host,
+		Status:    raw.Status,
+		Size:      max(raw.Size, raw.Bytes),
+		Referer:   raw.Referer,
+		UserAgent: raw.UserAgent,
+		Headers:   raw.Headers,
+		Body:      raw.Body,
+	}
+	for _, url := range []string{raw.URL, raw.URI, raw.RequestURI, raw.Path} {
+		if url != "" {
+			entry.URL = url
+			break
+		}
+	}
+	// "request" is the request line, like "GET /path HTTP/1.1".
+	if fields := strings.Fields(raw.Request); len(fields) >= 2 {
+		if entry.Method == "" {
+			entry.Method = fields[0]
+		}
+		if entry.URL == "" {
+			entry.URL = fields[1]
+		}
+	}
+	if entry.Method == "" {
+		entry.Method = "GET"
+	}
+	if entry.URL == "" {
+		return nil, errors.New("no url, uri, path or request field")
+	}
+
+	var err error
+	for _, value := range []json.RawMessage{raw.Time, raw.Timestamp, raw.Ts} {
+		if len(value) > 0 {
+			entry.Time, err = parseLogTime(value)
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if entry.Time.IsZero() {
+		return nil, errors.New("no time, timestamp or ts field")
+	}
+	return entry, nil
+}
+
+// parseLogTime accepts RFC 3339, the Common Log Format and Unix seconds as
+// a number or a string.
+func parseLogTime(value json.RawMessage) (time.Time, error) {
+	var seconds float64
+	if err := json.Unmarshal(value, &seconds); err == nil {
+		return unixSeconds(seconds), nil
+	}
+
+	var text string
+	if err := json.Unmarshal(value, &text); err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %s", value)
+	}
+	if seconds, err := strconv.ParseFloat(text, 64); err == nil {
+		return unixSeconds(seconds), nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, CLF_TIME_LAYOUT} {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", text)
+}
+
+func unixSeconds(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
@@ -0,0 +1,239 @@
+package core
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_TOKEN_REFRESH_BEFORE = 30 * time.Second
+	MAX_TOKEN_RESPONSE_SIZE      = 1 << 20
+)
+
+type AuthType int
+
+const (
+	AUTH_NONE AuthType = iota
+	AUTH_BASIC
+	AUTH_BEARER
+	AUTH_OAUTH2_CLIENT_CREDENTIALS
+	AUTH_OAUTH2_PASSWORD
+)
+
+func (t AuthType) String() string {
+	return [...]string{"None", "Basic", "Bearer", "OAuth2 client credentials", "OAuth2 password"}[t]
+}
+
+type TokenCache int
+
+const (
+	TOKEN_CACHE_GLOBAL TokenCache = iota
+	TOKEN_CACHE_PER_WORKER
+)
+
+func (c TokenCache) String() string {
+	return [...]string{"Global", "Per worker"}[c]
+}
+
+type AuthConfig struct {
+	Type AuthType
+
+	// Basic auth and OAuth2 password flow
+	Username string
+	Password string
+
+	// Static bearer token
+	Token string
+
+	// OAuth2 flows
+	TokenURL      string
+	ClientID      string
+	ClientSecret  string
+	Scopes        []string
+	Cache         TokenCache
+	RefreshBefore time.Duration
+}
+
+type authenticator struct {
+	cfg    *AuthConfig
+	client *http.Client
+
+	mu           sync.Mutex
+	token        string
+	refreshToken string
+	expiry       time.Time
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func ValidateAuthConfig(cfg *AuthConfig) error {
+	if cfg == nil {
+		return nil
+	}
+
+	switch cfg.Type {
+	case AUTH_NONE:
+	case AUTH_BASIC:
+		if cfg.Username == "" {
+			return errors.New("basic auth requires a username")
+		}
+	case AUTH_BEARER:
+		if cfg.Token == "" {
+			return errors.New("bearer auth requires a token")
+		}
+	case AUTH_OAUTH2_CLIENT_CREDENTIALS, AUTH_OAUTH2_PASSWORD:
+		tokenURL, err := url.Parse(cfg.TokenURL)
+		if err != nil || tokenURL.Host == "" || !strings.HasPrefix(tokenURL.Scheme, "http") {
+			return errors.New("OAuth2 requires a valid token URL")
+		}
+		if cfg.ClientID == "" {
+			return errors.New("OAuth2 requires a client ID")
+		}
+		if cfg.Type == AUTH_OAUTH2_PASSWORD && cfg.Username == "" {
+			return errors.New("OAuth2 password flow requires a username")
+		}
+	default:
+		return errors.New("unsupported auth type")
+	}
+
+	return nil
+}
+
+func newAuthenticator(cfg *AuthConfig, client *http.Client) (*authenticator, error) {
+	if cfg == nil || cfg.Type == AUTH_NONE {
+		return nil, nil
+	}
+
+	if err := ValidateAuthConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	return &authenticator{cfg: cfg, client: client}, nil
+}
+
+// authorize sets the Authorization header, fetching or refreshing the OAuth2
+// token first when it is missing or about to expire.
+func (a *authenticator) authorize(ctx context.Context, header http.Header) error {
+	if a == nil {
+		return nil
+	}
+
+	switch a.cfg.Type {
+	case AUTH_BASIC:
+		credential := base64.StdEncoding.EncodeToString([]byte(a.cfg.Username + ":" + a.cfg.Password))
+		header.Set("Authorization", "Basic "+credential)
+	case AUTH_BEARER:
+		header.Set("Authorization", "Bearer "+a.cfg.Token)
+	case AUTH_OAUTH2_CLIENT_CREDENTIALS, AUTH_OAUTH2_PASSWORD:
+		token, err := a.currentToken(ctx)
+		if err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	return nil
+}
+
+func (a *authenticator) currentToken(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	refreshBefore := a.cfg.RefreshBefore
+	if refreshBefore == 0 {
+		refreshBefore = DEFAULT_TOKEN_REFRESH_BEFORE
+	}
+
+	if a.token != "" && (a.expiry.IsZero() || time.Until(a.expiry) > refreshBefore) {
+		return a.token, nil
+	}
+
+	var resp *tokenResponse
+	var err error
+
+	if a.refreshToken != "" {
+		resp, err = a.requestToken(ctx, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {a.refreshToken},
+		})
+	}
+
+	if resp == nil {
+		form := url.Values{}
+		switch a.cfg.Type {
+		case AUTH_OAUTH2_CLIENT_CREDENTIALS:
+			form.Set("grant_type", "client_credentials")
+		case AUTH_OAUTH2_PASSWORD:
+			form.Set("grant_type", "password")
+			form.Set("username", a.cfg.Username)
+			form.Set("password", a.cfg.Password)
+		}
+		resp, err = a.requestToken(ctx, form)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	a.token = resp.AccessToken
+	a.refreshToken = resp.RefreshToken
+	a.expiry = time.Time{}
+	if resp.ExpiresIn > 0 {
+		a.expiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+
+	return a.token, nil
+}
+
+func (a *authenticator) requestToken(ctx context.Context, form url.Values) (*tokenResponse, error) {
+	if len(a.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(a.cfg.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(a.cfg.ClientID), url.QueryEscape(a.cfg.ClientSecret))
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MAX_TOKEN_RESPONSE_SIZE))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %s: %s", resp.Status, TruncateString(string(body), 200))
+	}
+
+	var token tokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("token response has no access_token")
+	}
+
+	return &token, nil
+}
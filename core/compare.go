@@ -0,0 +1,135 @@
+package core
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	DEFAULT_REGRESSION_TOLERANCE = 0.1
+)
+
+type MetricDiff struct {
+	Name     string
+	Baseline float64
+	Current  float64
+	// Relative change, 0.25 means the current value is 25% higher
+	Change float64
+	// HigherIsBetter is true for throughput, false for latency and errors
+	HigherIsBetter bool
+	Regression     bool
+}
+
+type EndpointComparison struct {
+	Url        string
+	Name       string
+	Metrics    []MetricDiff
+	Regression bool
+	// Missing is set when the endpoint exists in only one of the runs
+	Missing bool
+}
+
+type Comparison struct {
+	Baseline  *TestReport
+	Current   *TestReport
+	Tolerance float64
+	Endpoints []*EndpointComparison
+}
+
+func (c *Comparison) HasRegressions() bool {
+	for _, endpoint := range c.Endpoints {
+		if endpoint.Regression {
+			return true
+		}
+	}
+	return false
+}
+
+// CompareReports diffs two runs per endpoint and marks every metric that got
+// worse by more than tolerance (0.1 = 10%) as a regression.
+func CompareReports(baseline, current *TestReport, tolerance float64) *Comparison {
+	if tolerance <= 0 {
+		tolerance = DEFAULT_REGRESSION_TOLERANCE
+	}
+
+	comparison := &Comparison{
+		Baseline:  baseline,
+		Current:   current,
+		Tolerance: tolerance,
+	}
+
+	baselineByKey := make(map[string]*RequestReport)
+	for _, rep := range baseline.Requests {
+		baselineByKey[endpointKey(rep)] = rep
+	}
+
+	seen := make(map[string]bool)
+	for _, cur := range current.Requests {
+		seen[endpointKey(cur)] = true
+		base, ok := baselineByKey[endpointKey(cur)]
+		if !ok {
+			comparison.Endpoints = append(comparison.Endpoints, &EndpointComparison{Url: cur.Url, Name: cur.Name, Missing: true})
+			continue
+		}
+		comparison.Endpoints = append(comparison.Endpoints, compareEndpoint(base, cur, tolerance))
+	}
+
+	for _, base := range baseline.Requests {
+		if !seen[endpointKey(base)] {
+			comparison.Endpoints = append(comparison.Endpoints, &EndpointComparison{Url: base.Url, Name: base.Name, Missing: true})
+		}
+	}
+
+	return comparison
+}
+
+func compareEndpoint(base, cur *RequestReport, tolerance float64) *EndpointComparison {
+	ms := func(d time.Duration) float64 {
+		return float64(d.Microseconds()) / 1000
+	}
+
+	endpoint := &EndpointComparison{
+		Url:  cur.Url,
+		Name: cur.Name,
+		Metrics: []MetricDiff{
+			{Name: "p50 response time, ms", Baseline: ms(base.ResponseTimePercentile(50)), Current: ms(cur.ResponseTimePercentile(50))},
+			{Name: "p90 response time, ms", Baseline: ms(base.ResponseTimePercentile(90)), Current: ms(cur.ResponseTimePercentile(90))},
+			{Name: "p99 response time, ms", Baseline: ms(base.ResponseTimePercentile(99)), Current: ms(cur.ResponseTimePercentile(99))},
+			{Name: "Throughput, req/s", Baseline: base.RequestsPerSecond(), Current: cur.RequestsPerSecond(), HigherIsBetter: true},
+			{Name: "Error rate, %", Baseline: base.ErrorRate() * 100, Current: cur.ErrorRate() * 100},
+		},
+	}
+
+	for i := range endpoint.Metrics {
+		metric := &endpoint.Metrics[i]
+		metric.Change = relativeChange(metric.Baseline, metric.Current)
+
+		worse := metric.Change > tolerance
+		if metric.HigherIsBetter {
+			worse = metric.Change < -tolerance
+		}
+		metric.Regression = worse
+		endpoint.Regression = endpoint.Regression || worse
+	}
+
+	return endpoint
+}
+
+// endpointKey matches named requests by name, so the same operation is
+// compared even when its URL changed between runs.
+func endpointKey(rep *RequestReport) string {
+	if rep.Name != "" {
+		return "name:" + rep.Group + "/" + rep.Name
+	}
+	return "url:" + rep.Url
+}
+
+func relativeChange(baseline, current float64) float64 {
+	if baseline == 0 {
+		if current == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return (current - baseline) / baseline
+}
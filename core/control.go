@@ -0,0 +1,304 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	MAX_LIVE_DELAY = 60 * time.Second
+)
+
+// TestControl pauses, resumes and adjusts a running test. While paused the
+// workers don't send, requests in flight still finish, and the paused time
+// doesn't count toward the test duration.
+type TestControl struct {
+	mu       sync.Mutex
+	started  time.Time
+	pausedAt time.Time
+	paused   time.Duration
+	// resumed is nil while running and closed on resume.
+	resumed chan struct{}
+	// changed is closed and replaced on every change.
+	changed chan struct{}
+	workers int
+	// rate is the target of SetRate, 0 without one. The delay follows the
+	// count of workers while it's set.
+	rate float64
+	// delay is read by every worker before each request.
+	delay atomic.Int64
+	// dropped counts the results sinks had no room for.
+	dropped atomic.Int64
+}
+
+// LoadEvent records a change of the load while the test ran.
+type LoadEvent struct {
+	// Offset from the start of the test
+	Time    time.Duration
+	Workers int
+	Delay   time.Duration
+}
+
+func (e LoadEvent) RequestsPerSecond() float64 {
+	if e.Delay <= 0 {
+		return 0
+	}
+	return float64(e.Workers) / e.Delay.Seconds()
+}
+
+func NewTestControl() *TestControl {
+	return &TestControl{changed: make(chan struct{})}
+}
+
+// Pause stops sending, it returns false when the test is already paused.
+func (c *TestControl) Pause() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.resumed != nil {
+		return false
+	}
+	c.pausedAt = time.Now()
+	c.resumed = make(chan struct{})
+	c.notify()
+	return true
+}
+
+// Resume continues a paused test, it returns false when it isn't paused.
+func (c *TestControl) Resume() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.resumed == nil {
+		return false
+	}
+	c.paused += time.Since(c.pausedAt)
+	close(c.resumed)
+	c.resumed = nil
+	c.notify()
+	return true
+}
+
+// SetWorkers starts or retires workers until n are running, retired workers
+// finish their current request first. With a target rate the delay changes
+// with them.
+func (c *TestControl) SetWorkers(n int) error {
+	if n < 1 || n > MAX_COUNT_WORKERS {
+		return fmt.Errorf("count of workers must be between 1 and %d, got %d", MAX_COUNT_WORKERS, n)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delay := time.Duration(c.delay.Load())
+	if c.rate > 0 {
+		delay = RateDelay(n, c.rate)
+		if err := checkLiveDelay(delay); err != nil {
+			return fmt.Errorf("%d workers can't send %v requests per second: %w", n, c.rate, err)
+		}
+	}
+	c.setLoad(n, delay)
+	return nil
+}
+
+// SetDelay changes the delay between the requests of each worker, it ends a
+// target rate.
+func (c *TestControl) SetDelay(d time.Duration) error {
+	if err := checkLiveDelay(d); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rate = 0
+	c.setLoad(c.workers, d)
+	return nil
+}
+
+// SetRate changes the delay so all workers together send rps requests per
+// second, and keeps it at that rate when the count of workers changes.
+func (c *TestControl) SetRate(rps float64) error {
+	if rps <= 0 {
+		return fmt.Errorf("target rate must be positive, got %v", rps)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delay := RateDelay(c.workers, rps)
+	if err := checkLiveDelay(delay); err != nil {
+		return err
+	}
+	c.rate = rps
+	c.setLoad(c.workers, delay)
+	return nil
+}
+
+func checkLiveDelay(d time.Duration) error {
+	if d < MIN_REQ_DELAY || d > MAX_LIVE_DELAY {
+		return fmt.Errorf("request delay must be between %v and %v, got %v", MIN_REQ_DELAY, MAX_LIVE_DELAY, d)
+	}
+	return nil
+}
+
+// setLoad stores the load and wakes the workers if it changed, c.mu must be
+// held.
+func (c *TestControl) setLoad(workers int, delay time.Duration) {
+	if c.workers == workers && time.Duration(c.delay.Load()) == delay {
+		return
+	}
+	c.workers = workers
+	c.delay.Store(int64(delay))
+	c.notify()
+}
+
+// RateDelay is the delay between the requests of each worker for workers to
+// send rps requests per second together.
+func RateDelay(workers int, rps float64) time.Duration {
+	return time.Duration(float64(workers) / rps * float64(time.Second))
+}
+
+func (c *TestControl) Workers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.workers
+}
+
+func (c *TestControl) Delay() time.Duration {
+	return time.Duration(c.delay.Load())
+}
+
+// Dropped is the count of results dropped by sinks with DROP_WHEN_FULL, like
+// the live preview of StartSendingRequests. The report never misses them.
+func (c *TestControl) Dropped() int64 {
+	return c.dropped.Load()
+}
+
+func (c *TestControl) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resumed != nil
+}
+
+// Elapsed is how long the test has been running, without pauses.
+func (c *TestControl) Elapsed() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.elapsed()
+}
+
+// PausedFor is the total time the test has been paused.
+func (c *TestControl) PausedFor() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.resumed != nil {
+		return c.paused + time.Since(c.pausedAt)
+	}
+	return c.paused
+}
+
+func (c *TestControl) elapsed() time.Duration {
+	if c.started.IsZero() {
+		return 0
+	}
+	now := time.Now()
+	if c.resumed != nil {
+		now = c.pausedAt
+	}
+	return now.Sub(c.started) - c.paused
+}
+
+func (c *TestControl) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// start begins counting the test time at t with the configured load, a test
+// paused before it started stays paused.
+func (c *TestControl) start(t time.Time, workers int, delay time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.started = t
+	c.paused = 0
+	if c.resumed != nil {
+		c.pausedAt = t
+	}
+	c.workers = workers
+	c.delay.Store(int64(delay))
+	c.dropped.Store(0)
+}
+
+// keepRate makes SetWorkers hold rps, for a test started at that rate.
+func (c *TestControl) keepRate(rps float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rate = rps
+}
+
+// load returns the requested load and a channel closed on the next change.
+func (c *TestControl) load() (int, time.Duration, <-chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.workers, time.Duration(c.delay.Load()), c.changed
+}
+
+// wait blocks while the test is paused. It reports whether it had to wait,
+// ok is false when ctx is done.
+func (c *TestControl) wait(ctx context.Context) (waited bool, ok bool) {
+	c.mu.Lock()
+	resumed := c.resumed
+	c.mu.Unlock()
+
+	if resumed == nil {
+		return false, ctx.Err() == nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return true, false
+	case <-resumed:
+		return true, ctx.Err() == nil
+	}
+}
+
+// enforceDuration calls cancel once the test has run for d, not counting
+// pauses.
+func (c *TestControl) enforceDuration(ctx context.Context, d time.Duration, cancel context.CancelFunc) {
+	for {
+		c.mu.Lock()
+		changed := c.changed
+		paused := c.resumed != nil
+		remaining := d - c.elapsed()
+		c.mu.Unlock()
+
+		if !paused && remaining <= 0 {
+			cancel()
+			return
+		}
+
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if !paused {
+			timer = time.NewTimer(remaining)
+			timeout = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+)
+
+type CookieConfig struct {
+	Enabled           bool
+	ResetPerIteration bool
+	// Cookies set into every new jar for the hosts of the configured requests
+	Seed []*http.Cookie
+}
+
+func ParseCookies(line string) ([]*http.Cookie, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil, nil
+	}
+	return http.ParseCookie(line)
+}
+
+// newCookieJar creates a jar for one worker, pre-seeded for every host the
+// worker can send requests to.
+func newCookieJar(cfg *CookieConfig, requests []Request) http.CookieJar {
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+
+	jar, _ := cookiejar.New(nil)
+
+	if len(cfg.Seed) > 0 {
+		seed := seedCookies(cfg.Seed)
+		for _, req := range requests {
+			reqURL, err := cookieURL(req.GetURI())
+			if err != nil {
+				continue
+			}
+			jar.SetCookies(reqURL, seed)
+		}
+	}
+
+	return jar
+}
+
+// seedCookies makes the seeded cookies host-only cookies for the whole site,
+// without a path the jar would limit them to the directory of the request.
+func seedCookies(cookies []*http.Cookie) []*http.Cookie {
+	seed := make([]*http.Cookie, len(cookies))
+	for i, cookie := range cookies {
+		c := *cookie
+		if c.Path == "" {
+			c.Path = "/"
+		}
+		c.Domain = ""
+		seed[i] = &c
+	}
+	return seed
+}
+
+func countCookies(jar http.CookieJar, rawURL string) int {
+	if jar == nil {
+		return 0
+	}
+
+	reqURL, err := cookieURL(rawURL)
+	if err != nil {
+		return 0
+	}
+
+	return len(jar.Cookies(reqURL))
+}
+
+// cookieURL maps ws and wss URLs to http and https, the jar ignores other schemes.
+func cookieURL(rawURL string) (*url.URL, error) {
+	reqURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch reqURL.Scheme {
+	case "ws":
+		reqURL.Scheme = "http"
+	case "wss":
+		reqURL.Scheme = "https"
+	}
+
+	return reqURL, nil
+}
@@ -0,0 +1,420 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// CurlRequest is a request imported from a curl command line. Insecure is set
+// when the command used -k, the caller decides whether to honour it.
+type CurlRequest struct {
+	Request  *HTTPRequest
+	Insecure bool
+}
+
+// curl options that take a value but have no effect on the request we build.
+var curlIgnoredValueFlags = map[string]bool{
+	"-o":                true,
+	"--output":          true,
+	"-m":                true,
+	"--max-time":        true,
+	"--connect-timeout": true,
+	"-w":                true,
+	"--write-out":       true,
+	"--retry":           true,
+	"-x":                true,
+	"--proxy":           true,
+	"--resolve":         true,
+	"-c":                true,
+	"--cookie-jar":      true,
+}
+
+// curl options without a value that are safe to skip.
+var curlIgnoredFlags = map[string]bool{
+	"-s":           true,
+	"--silent":     true,
+	"-S":           true,
+	"--show-error": true,
+	"-L":           true,
+	"--location":   true,
+	"-i":           true,
+	"--include":    true,
+	"-v":           true,
+	"--verbose":    true,
+	"-f":           true,
+	"--fail":       true,
+	"-g":           true,
+	"--globoff":    true,
+	"--http1.1":    true,
+	"--http2":      true,
+}
+
+// ParseCurlCommands parses one or more curl commands. Every command starts with
+// the word curl on a new line or after ; or &&, line continuations with a
+// trailing backslash are supported.
+func ParseCurlCommands(text string) ([]*CurlRequest, error) {
+	args, starts, err := splitShellWords(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var commands [][]string
+	for i, arg := range args {
+		if arg == "curl" && starts[i] {
+			commands = append(commands, nil)
+			continue
+		}
+		if len(commands) == 0 {
+			return nil, errors.New("command must start with curl")
+		}
+		commands[len(commands)-1] = append(commands[len(commands)-1], arg)
+	}
+	if len(commands) == 0 {
+		return nil, errors.New("no curl commands found")
+	}
+
+	requests := make([]*CurlRequest, 0, len(commands))
+	for i, command := range commands {
+		req, err := parseCurlArgs(command)
+		if err != nil {
+			if len(commands) > 1 {
+				return nil, fmt.Errorf("command %d: %w", i+1, err)
+			}
+			return nil, err
+		}
+		requests = append(requests, req)
+	}
+
+	return requests, nil
+}
+
+// ParseCurl parses a single curl command.
+func ParseCurl(command string) (*CurlRequest, error) {
+	requests, err := ParseCurlCommands(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(requests) != 1 {
+		return nil, fmt.Errorf("expected one curl command, got %d", len(requests))
+	}
+	return requests[0], nil
+}
+
+func parseCurlArgs(args []string) (*CurlRequest, error) {
+	var (
+		method   string
+		rawURL   string
+		data     []string
+		user     string
+		insecure bool
+		header   = make(http.Header)
+	)
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			if rawURL != "" {
+				return nil, fmt.Errorf("unexpected argument %q", arg)
+			}
+			rawURL = arg
+			continue
+		}
+
+		name, value, hasValue := splitCurlFlag(arg)
+		takeValue := func() (string, error) {
+			if hasValue {
+				return value, nil
+			}
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("option %s requires a value", name)
+			}
+			i++
+			return args[i], nil
+		}
+
+		var err error
+		switch name {
+		case "-X", "--request":
+			method, err = takeValue()
+			method = strings.ToUpper(method)
+		case "--url":
+			rawURL, err = takeValue()
+		case "-H", "--header":
+			var h string
+			if h, err = takeValue(); err == nil {
+				err = addCurlHeader(header, h)
+			}
+		case "-d", "--data", "--data-ascii":
+			var d string
+			if d, err = takeValue(); err == nil {
+				if strings.HasPrefix(d, "@") {
+					d, err = readCurlDataFile(d[1:])
+					d = strings.NewReplacer("\r", "", "\n", "").Replace(d)
+				}
+				data = append(data, d)
+			}
+		case "--data-binary":
+			var d string
+			if d, err = takeValue(); err == nil {
+				if strings.HasPrefix(d, "@") {
+					d, err = readCurlDataFile(d[1:])
+				}
+				data = append(data, d)
+			}
+		case "--data-raw":
+			var d string
+			if d, err = takeValue(); err == nil {
+				data = append(data, d)
+			}
+		case "-u", "--user":
+			user, err = takeValue()
+		case "-A", "--user-agent":
+			var ua string
+			if ua, err = takeValue(); err == nil {
+				header.Set("User-Agent", ua)
+			}
+		case "-e", "--referer":
+			var ref string
+			if ref, err = takeValue(); err == nil {
+				header.Set("Referer", ref)
+			}
+		case "-b", "--cookie":
+			var c string
+			if c, err = takeValue(); err == nil {
+				if !strings.Contains(c, "=") {
+					return nil, errors.New("reading cookies from a file is not supported")
+				}
+				header.Add("Cookie", c)
+			}
+		case "-k", "--insecure":
+			insecure = true
+		case "--compressed":
+			// Go asks for gzip and decodes it by itself, setting
+			// Accept-Encoding would turn that off.
+		case "-G", "--get":
+			return nil, fmt.Errorf("unsupported curl option %s, put the data into the URL query instead", name)
+		case "-I", "--head":
+			method = http.MethodHead
+		default:
+			switch {
+			case curlIgnoredValueFlags[name]:
+				_, err = takeValue()
+			case curlIgnoredFlags[name]:
+			case isCurlFlagGroup(name):
+				for _, c := range name[1:] {
+					if c == 'k' {
+						insecure = true
+					}
+				}
+			default:
+				return nil, fmt.Errorf("unsupported curl option %s", name)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if rawURL == "" {
+		return nil, errors.New("URL is missing")
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	protocol := HTTP
+	rawURL, err := ValidateURL(rawURL, &protocol)
+	if err != nil {
+		return nil, err
+	}
+
+	body := []byte(strings.Join(data, "&"))
+	if method == "" {
+		method = http.MethodGet
+		if len(data) > 0 {
+			method = http.MethodPost
+		}
+	}
+	if len(data) > 0 && header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	req, err := http.NewRequest(method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if host := header.Get("Host"); host != "" {
+		req.Host = host
+		header.Del("Host")
+	}
+	req.Header = header
+	if user != "" {
+		username, password, _ := strings.Cut(user, ":")
+		req.SetBasicAuth(username, password)
+	}
+
+	return &CurlRequest{
+		Request:  &HTTPRequest{Request: req, CachedBody: body},
+		Insecure: insecure,
+	}, nil
+}
+
+// splitCurlFlag separates attached values: --data=x, -XPOST, -H'Accept: x'.
+func splitCurlFlag(arg string) (name, value string, hasValue bool) {
+	if strings.HasPrefix(arg, "--") {
+		name, value, hasValue = strings.Cut(arg, "=")
+		return name, value, hasValue
+	}
+	if len(arg) > 2 && strings.ContainsRune("XHdubAeowmx", rune(arg[1])) {
+		return arg[:2], arg[2:], true
+	}
+	return arg, "", false
+}
+
+func isCurlFlagGroup(name string) bool {
+	if len(name) < 3 || strings.HasPrefix(name, "--") {
+		return false
+	}
+	for _, c := range name[1:] {
+		if c != 'k' && !curlIgnoredFlags["-"+string(c)] {
+			return false
+		}
+	}
+	return true
+}
+
+func addCurlHeader(header http.Header, line string) error {
+	key, value, ok := strings.Cut(line, ":")
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return fmt.Errorf("invalid header %q", line)
+	}
+	if !ok {
+		// curl removes a header passed as "Name;" or "Name:" without a value
+		header.Del(strings.TrimSuffix(key, ";"))
+		return nil
+	}
+	header.Add(key, strings.TrimSpace(value))
+	return nil
+}
+
+func readCurlDataFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read request body: %w", err)
+	}
+	return string(data), nil
+}
+
+// splitShellWords splits text the way a POSIX shell would for the quoting
+// curl commands use in practice: single quotes, double quotes, $'...' and
+// backslash escapes and line continuations. starts[i] is set when word i is
+// in command position, first or after a newline, ; or &&.
+func splitShellWords(text string) (words []string, starts []bool, err error) {
+	var (
+		current strings.Builder
+		inWord  bool
+		atStart = true
+	)
+	endWord := func() {
+		if inWord {
+			words = append(words, current.String())
+			starts = append(starts, atStart)
+			current.Reset()
+			inWord = false
+			atStart = false
+		}
+	}
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == '\\':
+			if i+1 < len(runes) {
+				i++
+				if runes[i] == '\r' && i+1 < len(runes) && runes[i+1] == '\n' {
+					i++
+				}
+				if runes[i] != '\n' {
+					current.WriteRune(runes[i])
+					inWord = true
+				}
+			}
+		case c == '\'':
+			end := indexRune(runes, i+1, '\'')
+			if end < 0 {
+				return nil, nil, errors.New("unterminated single quote")
+			}
+			current.WriteString(string(runes[i+1 : end]))
+			inWord = true
+			i = end
+		case c == '$' && i+1 < len(runes) && runes[i+1] == '\'':
+			i += 2
+			for ; i < len(runes) && runes[i] != '\''; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+					switch runes[i] {
+					case 'n':
+						current.WriteRune('\n')
+					case 't':
+						current.WriteRune('\t')
+					case 'r':
+						current.WriteRune('\r')
+					default:
+						current.WriteRune(runes[i])
+					}
+					continue
+				}
+				current.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, nil, errors.New("unterminated $' quote")
+			}
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$`\n", runes[i+1]) {
+					i++
+					if runes[i] == '\n' {
+						continue
+					}
+				}
+				current.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, nil, errors.New("unterminated double quote")
+			}
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\r':
+			endWord()
+		case c == '\n' || c == ';':
+			endWord()
+			atStart = true
+		case c == '&' && i+1 < len(runes) && runes[i+1] == '&':
+			endWord()
+			atStart = true
+			i++
+		default:
+			current.WriteRune(c)
+			inWord = true
+		}
+	}
+	endWord()
+
+	return words, starts, nil
+}
+
+func indexRune(runes []rune, from int, r rune) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
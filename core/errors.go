@@ -0,0 +1,167 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	MAX_ERROR_SAMPLE_LEN = 300
+)
+
+type ErrorCategory int
+
+const (
+	ERR_OTHER ErrorCategory = iota
+	ERR_TIMEOUT
+	ERR_CONNECTION_REFUSED
+	ERR_CONNECTION_RESET
+	ERR_DNS
+	ERR_TLS
+	ERR_EOF
+	ERR_CANCELED
+	ERR_PROXY
+	ERR_WS_CLOSE
+	ERR_SCRIPT
+)
+
+func (c ErrorCategory) String() string {
+	return [...]string{
+		"Other",
+		"Timeout",
+		"Connection refused",
+		"Connection reset",
+		"DNS failure",
+		"TLS error",
+		"Unexpected EOF",
+		"Canceled",
+		"Proxy error",
+		"WebSocket closed",
+		"Script error",
+	}[c]
+}
+
+// ErrorClass is the stable identity of an error, Code is the close code for
+// ERR_WS_CLOSE.
+type ErrorClass struct {
+	Category ErrorCategory
+	Code     int
+}
+
+func (c ErrorClass) String() string {
+	if c.Category == ERR_WS_CLOSE {
+		return fmt.Sprintf("%s (%d)", c.Category, c.Code)
+	}
+	return c.Category.String()
+}
+
+// ErrorSummary counts the errors of one class and keeps the first raw
+// message as an example.
+type ErrorSummary struct {
+	Category ErrorCategory
+	Code     int
+	Count    int
+	Sample   string
+}
+
+func (s *ErrorSummary) Class() ErrorClass {
+	return ErrorClass{Category: s.Category, Code: s.Code}
+}
+
+func parseErrorCategory(name string) ErrorCategory {
+	for c := ERR_OTHER; c <= ERR_SCRIPT; c++ {
+		if c.String() == name {
+			return c
+		}
+	}
+	return ERR_OTHER
+}
+
+// loggedError is an error read back from a result log, it keeps the class
+// it had when it was logged.
+type loggedError struct {
+	class   ErrorClass
+	message string
+}
+
+func (e *loggedError) Error() string {
+	return e.message
+}
+
+// ClassifyError maps err to a category that doesn't depend on addresses,
+// ports or other details that change between requests.
+func ClassifyError(err error) ErrorClass {
+	var logged *loggedError
+	var proxyErr *ProxyError
+	var scriptErr *ScriptError
+	var closeErr *websocket.CloseError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &logged):
+		return logged.class
+	case errors.As(err, &scriptErr):
+		return ErrorClass{Category: ERR_SCRIPT}
+	case errors.As(err, &proxyErr):
+		return ErrorClass{Category: ERR_PROXY}
+	case errors.Is(err, context.Canceled):
+		return ErrorClass{Category: ERR_CANCELED}
+	case errors.As(err, &closeErr):
+		return ErrorClass{Category: ERR_WS_CLOSE, Code: closeErr.Code}
+	case errors.As(err, &dnsErr):
+		return ErrorClass{Category: ERR_DNS}
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorClass{Category: ERR_TIMEOUT}
+	case isTLSError(err):
+		return ErrorClass{Category: ERR_TLS}
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorClass{Category: ERR_CONNECTION_REFUSED}
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE), errors.Is(err, syscall.ECONNABORTED):
+		return ErrorClass{Category: ERR_CONNECTION_RESET}
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorClass{Category: ERR_EOF}
+	}
+
+	// Errors that lost their type on the way, e.g. through fmt.Errorf with %v.
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "connection refused"):
+		return ErrorClass{Category: ERR_CONNECTION_REFUSED}
+	case strings.Contains(message, "connection reset"), strings.Contains(message, "broken pipe"):
+		return ErrorClass{Category: ERR_CONNECTION_RESET}
+	case strings.Contains(message, "no such host"):
+		return ErrorClass{Category: ERR_DNS}
+	case strings.Contains(message, "timeout"), strings.Contains(message, "deadline exceeded"):
+		return ErrorClass{Category: ERR_TIMEOUT}
+	case strings.Contains(message, "tls:"), strings.Contains(message, "x509:"):
+		return ErrorClass{Category: ERR_TLS}
+	case strings.HasSuffix(message, "EOF"):
+		return ErrorClass{Category: ERR_EOF}
+	}
+
+	return ErrorClass{Category: ERR_OTHER}
+}
+
+func isTLSError(err error) bool {
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var verifyErr *tls.CertificateVerificationError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+
+	return errors.As(err, &recordErr) || errors.As(err, &alertErr) || errors.As(err, &verifyErr) ||
+		errors.As(err, &unknownAuthErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr)
+}
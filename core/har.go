@@ -0,0 +1,319 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Response content types that are usually not worth load testing.
+var StaticContentTypes = []string{"image/", "font/", "text/css", "javascript", "video/", "audio/"}
+
+// HARFilter selects which recorded entries are imported. Domains match the
+// host and its subdomains, content types match the recorded response type by
+// substring. Empty lists match everything.
+type HARFilter struct {
+	Domains             []string
+	ContentTypes        []string
+	ExcludeContentTypes []string
+	// DropCookies leaves out the captured Cookie headers, for when the cookie
+	// jar keeps the cookies instead.
+	DropCookies bool
+}
+
+type harFile struct {
+	Log struct {
+		Version string     `json:"version"`
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time `json:"startedDateTime"`
+	Request         struct {
+		Method   string         `json:"method"`
+		URL      string         `json:"url"`
+		Headers  []harNameValue `json:"headers"`
+		PostData *struct {
+			MimeType string         `json:"mimeType"`
+			Text     string         `json:"text"`
+			Params   []harNameValue `json:"params"`
+		} `json:"postData"`
+	} `json:"request"`
+	Response struct {
+		Content struct {
+			MimeType string `json:"mimeType"`
+		} `json:"content"`
+	} `json:"response"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ImportHAR reads a HAR 1.2 log and returns the matching entries in the order
+// they were recorded, with the original pauses between them.
+func ImportHAR(r io.Reader, filter HARFilter) ([]ScenarioStep, error) {
+	var har harFile
+	if err := json.NewDecoder(r).Decode(&har); err != nil {
+		return nil, fmt.Errorf("invalid HAR file: %w", err)
+	}
+	if har.Log.Entries == nil {
+		return nil, errors.New("invalid HAR file: no log entries")
+	}
+
+	entries := har.Log.Entries
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].StartedDateTime.Before(entries[j].StartedDateTime)
+	})
+
+	var steps []ScenarioStep
+	var prevStarted time.Time
+	for _, entry := range entries {
+		parsedURL, err := url.Parse(entry.Request.URL)
+		if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+			continue
+		}
+		if !filter.match(parsedURL.Hostname(), entry.Response.Content.MimeType) {
+			continue
+		}
+
+		req, err := newHARRequest(&entry, filter.DropCookies)
+		if err != nil {
+			return nil, fmt.Errorf("entry %s %s: %w", entry.Request.Method, entry.Request.URL, err)
+		}
+
+		step := ScenarioStep{Request: req}
+		if len(steps) > 0 {
+			step.Delay = max(entry.StartedDateTime.Sub(prevStarted), 0)
+		}
+		prevStarted = entry.StartedDateTime
+		steps = append(steps, step)
+	}
+
+	if len(steps) == 0 {
+		return nil, errors.New("no requests match the filter")
+	}
+
+	return steps, nil
+}
+
+func (f HARFilter) match(host, contentType string) bool {
+	host = strings.ToLower(host)
+	if len(f.Domains) > 0 {
+		matched := false
+		for _, domain := range f.Domains {
+			domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "."))
+			if domain != "" && (host == domain || strings.HasSuffix(host, "."+domain)) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	contentType = strings.ToLower(contentType)
+	for _, excluded := range f.ExcludeContentTypes {
+		if excluded = strings.ToLower(strings.TrimSpace(excluded)); excluded != "" && strings.Contains(contentType, excluded) {
+			return false
+		}
+	}
+
+	if len(f.ContentTypes) == 0 {
+		return true
+	}
+	for _, included := range f.ContentTypes {
+		if included = strings.ToLower(strings.TrimSpace(included)); included != "" && strings.Contains(contentType, included) {
+			return true
+		}
+	}
+	return false
+}
+
+func newHARRequest(entry *harEntry, dropCookies bool) (*HTTPRequest, error) {
+	var body []byte
+	if postData := entry.Request.PostData; postData != nil {
+		if postData.Text != "" {
+			body = []byte(postData.Text)
+		} else if len(postData.Params) > 0 {
+			form := url.Values{}
+			for _, param := range postData.Params {
+				form.Add(param.Name, param.Value)
+			}
+			body = []byte(form.Encode())
+		}
+	}
+
+	req, err := http.NewRequest(strings.ToUpper(entry.Request.Method), entry.Request.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, h := range entry.Request.Headers {
+		switch strings.ToLower(h.Name) {
+		case "host":
+			req.Host = h.Value
+		case "content-length", "connection", "accept-encoding":
+			// Set by the transport, which only decodes what it asked for.
+		case "cookie":
+			if !dropCookies {
+				req.Header.Add(h.Name, h.Value)
+			}
+		default:
+			// HTTP/2 pseudo headers like :authority are not real headers.
+			if !strings.HasPrefix(h.Name, ":") {
+				req.Header.Add(h.Name, h.Value)
+			}
+		}
+	}
+	if postData := entry.Request.PostData; postData != nil && postData.MimeType != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", postData.MimeType)
+	}
+
+	return &HTTPRequest{Request: req, CachedBody: body}, nil
+}
+
+type harExport struct {
+	Log harExportLog `json:"log"`
+}
+
+type harExportLog struct {
+	Version string `json:"version"`
+	Creator struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"creator"`
+	Entries []harExportEntry `json:"entries"`
+}
+
+type harExportEntry struct {
+	StartedDateTime time.Time         `json:"startedDateTime"`
+	Time            float64           `json:"time"`
+	Request         harExportRequest  `json:"request"`
+	Response        harExportResponse `json:"response"`
+	Cache           struct{}          `json:"cache"`
+	Timings         harExportTimings  `json:"timings"`
+}
+
+type harExportRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harExportResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     struct {
+		Size     int    `json:"size"`
+		MimeType string `json:"mimeType"`
+	} `json:"content"`
+	RedirectURL string `json:"redirectURL"`
+	HeadersSize int    `json:"headersSize"`
+	BodySize    int    `json:"bodySize"`
+}
+
+type harExportTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// WriteHAR saves recorded requests as a HAR 1.2 log that ImportHAR and
+// browsers can read. Only what the recorder saw is filled in, sizes it
+// doesn't know are -1.
+func WriteHAR(w io.Writer, records []RecordedRequest) error {
+	har := harExport{Log: harExportLog{
+		Version: "1.2",
+		Entries: make([]harExportEntry, 0, len(records)),
+	}}
+	har.Log.Creator.Name = "TestYourServer recorder"
+	har.Log.Creator.Version = "1.0"
+
+	for _, record := range records {
+		entry := harExportEntry{
+			StartedDateTime: record.Time,
+			Time:            float64(record.Duration.Microseconds()) / 1000,
+			Request: harExportRequest{
+				Method:      record.Method,
+				URL:         record.URL,
+				HTTPVersion: "HTTP/1.1",
+				Cookies:     []harNameValue{},
+				Headers:     harHeaders(record.Header),
+				QueryString: []harNameValue{},
+				HeadersSize: -1,
+				BodySize:    len(record.Body),
+			},
+			Response: harExportResponse{
+				Status:      record.Status,
+				StatusText:  http.StatusText(record.Status),
+				HTTPVersion: "HTTP/1.1",
+				Cookies:     []harNameValue{},
+				Headers:     []harNameValue{},
+				HeadersSize: -1,
+				BodySize:    -1,
+			},
+			Timings: harExportTimings{Wait: float64(record.Duration.Microseconds()) / 1000},
+		}
+		if parsedURL, err := url.Parse(record.URL); err == nil {
+			for name, values := range parsedURL.Query() {
+				for _, value := range values {
+					entry.Request.QueryString = append(entry.Request.QueryString, harNameValue{Name: name, Value: value})
+				}
+			}
+		}
+		if len(record.Body) > 0 {
+			entry.Request.PostData = &harPostData{MimeType: record.Header.Get("Content-Type"), Text: string(record.Body)}
+		}
+		entry.Response.Content.Size = -1
+		entry.Response.Content.MimeType = record.ContentType
+		if record.ContentType != "" {
+			entry.Response.Headers = append(entry.Response.Headers, harNameValue{Name: "Content-Type", Value: record.ContentType})
+		}
+		har.Log.Entries = append(har.Log.Entries, entry)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(har)
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	headers := []harNameValue{}
+	for _, name := range names {
+		for _, value := range header[name] {
+			headers = append(headers, harNameValue{Name: name, Value: value})
+		}
+	}
+	return headers
+}
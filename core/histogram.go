@@ -0,0 +1,114 @@
+package core
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// Values below HISTOGRAM_EXACT_LIMIT get their own bucket, larger values
+	// share buckets with a relative error of at most 1/HISTOGRAM_SUB_BUCKETS.
+	HISTOGRAM_SUB_BUCKETS = 64
+	HISTOGRAM_EXACT_LIMIT = 2 * HISTOGRAM_SUB_BUCKETS
+)
+
+// Histogram is a sparse log-linear histogram of non-negative values. It keeps
+// memory bounded no matter how many values are recorded and can be merged.
+type Histogram struct {
+	Counts map[int]int64
+	Total  int64
+	Sum    int64
+	Min    int64
+	Max    int64
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{Counts: make(map[int]int64)}
+}
+
+func histogramBucket(v int64) int {
+	if v < HISTOGRAM_EXACT_LIMIT {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - bits.Len64(HISTOGRAM_EXACT_LIMIT-1)
+	mantissa := int(v >> shift)
+	return HISTOGRAM_EXACT_LIMIT + (shift-1)*HISTOGRAM_SUB_BUCKETS + mantissa - HISTOGRAM_SUB_BUCKETS
+}
+
+// histogramBucketRange returns the smallest and largest value of a bucket.
+func histogramBucketRange(bucket int) (int64, int64) {
+	if bucket < HISTOGRAM_EXACT_LIMIT {
+		return int64(bucket), int64(bucket)
+	}
+	shift := (bucket-HISTOGRAM_EXACT_LIMIT)/HISTOGRAM_SUB_BUCKETS + 1
+	mantissa := int64((bucket-HISTOGRAM_EXACT_LIMIT)%HISTOGRAM_SUB_BUCKETS + HISTOGRAM_SUB_BUCKETS)
+	return mantissa << shift, (mantissa+1)<<shift - 1
+}
+
+func (h *Histogram) Record(v int64) {
+	if v < 0 {
+		v = 0
+	}
+
+	if h.Total == 0 || v < h.Min {
+		h.Min = v
+	}
+	h.Max = max(h.Max, v)
+	h.Total++
+	h.Sum += v
+	h.Counts[histogramBucket(v)]++
+}
+
+func (h *Histogram) Merge(other *Histogram) {
+	if other == nil || other.Total == 0 {
+		return
+	}
+
+	if h.Total == 0 || other.Min < h.Min {
+		h.Min = other.Min
+	}
+	h.Max = max(h.Max, other.Max)
+	h.Total += other.Total
+	h.Sum += other.Sum
+	for bucket, count := range other.Counts {
+		h.Counts[bucket] += count
+	}
+}
+
+func (h *Histogram) Mean() float64 {
+	if h == nil || h.Total == 0 {
+		return 0
+	}
+	return float64(h.Sum) / float64(h.Total)
+}
+
+// Percentile returns the value below which p percent of the recorded values fall.
+func (h *Histogram) Percentile(p float64) int64 {
+	if h == nil || h.Total == 0 {
+		return 0
+	}
+	if p >= 100 {
+		return h.Max
+	}
+
+	rank := int64(math.Ceil(p / 100 * float64(h.Total)))
+	rank = min(max(rank, 1), h.Total)
+
+	buckets := make([]int, 0, len(h.Counts))
+	for bucket := range h.Counts {
+		buckets = append(buckets, bucket)
+	}
+	sort.Ints(buckets)
+
+	var seen int64
+	for _, bucket := range buckets {
+		seen += h.Counts[bucket]
+		if seen >= rank {
+			low, high := histogramBucketRange(bucket)
+			return min(max((low+high)/2, h.Min), h.Max)
+		}
+	}
+
+	return h.Max
+}
@@ -0,0 +1,130 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	HISTORY_ID_LAYOUT = "20060102-150405.000000"
+	HISTORY_DIR_NAME  = "TestYourServer"
+	HISTORY_FILE_EXT  = ".json"
+)
+
+// NewRunID names a run started at t. Runs started in the same microsecond,
+// e.g. by several Runners, still get their own ID thanks to the random suffix.
+func NewRunID(t time.Time) string {
+	return fmt.Sprintf("%s-%04x", t.Format(HISTORY_ID_LAYOUT), rand.Intn(0x10000))
+}
+
+// HistoryStore keeps completed runs as JSON files in a local directory.
+type HistoryStore struct {
+	dir string
+}
+
+func DefaultHistoryDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, HISTORY_DIR_NAME, "history"), nil
+}
+
+func NewHistoryStore(dir string) (*HistoryStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	return &HistoryStore{dir: dir}, nil
+}
+
+func (s *HistoryStore) path(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") {
+		return "", fmt.Errorf("invalid run ID: %q", id)
+	}
+	return filepath.Join(s.dir, id+HISTORY_FILE_EXT), nil
+}
+
+func (s *HistoryStore) Save(report *TestReport) error {
+	if report == nil {
+		return errors.New("nothing to save")
+	}
+
+	path, err := s.path(report.ID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a broken run.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *HistoryStore) Load(id string) (*TestReport, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var report TestReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to read run %s: %w", id, err)
+	}
+
+	return &report, nil
+}
+
+// List returns all stored runs, newest first.
+func (s *HistoryStore) List() ([]*TestReport, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]*TestReport, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != HISTORY_FILE_EXT {
+			continue
+		}
+
+		report, err := s.Load(strings.TrimSuffix(entry.Name(), HISTORY_FILE_EXT))
+		if err != nil {
+			fmt.Println("skipping history entry:", err)
+			continue
+		}
+		reports = append(reports, report)
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Started.After(reports[j].Started)
+	})
+
+	return reports, nil
+}
+
+func (s *HistoryStore) Delete(id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,570 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	OPENAPI_MAX_SAMPLE_DEPTH = 6
+	OPENAPI_MAX_REF_HOPS     = 16
+)
+
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+type OpenAPISpec struct {
+	Title      string
+	Servers    []string
+	Operations []*OpenAPIOperation
+}
+
+// OpenAPIOperation is one operation of the spec with its parameters and body
+// already filled from examples or generated sample data.
+type OpenAPIOperation struct {
+	// operationId, or "METHOD /path" when the spec has none
+	ID      string
+	Method  string
+	Path    string
+	Summary string
+	Tags    []string
+
+	path   string
+	query  url.Values
+	header http.Header
+	body   []byte
+}
+
+// NewRequest builds the request against baseURL, usually one of the spec's
+// servers.
+func (op *OpenAPIOperation) NewRequest(baseURL string) (*HTTPRequest, error) {
+	baseURL = strings.TrimSpace(baseURL)
+	if !IsAbsoluteServerURL(baseURL) {
+		return nil, fmt.Errorf("base URL %q has no host, enter the full URL of the API, like https://api.example.com%s", baseURL, baseURL)
+	}
+
+	protocol := HTTP
+	rawURL, err := ValidateURL(strings.TrimSuffix(baseURL, "/")+op.path, &protocol)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op.ID, err)
+	}
+
+	req, err := http.NewRequest(op.Method, rawURL, bytes.NewReader(op.body))
+	if err != nil {
+		return nil, err
+	}
+	if len(op.query) > 0 {
+		query := req.URL.Query()
+		for key, values := range op.query {
+			query[key] = append(query[key], values...)
+		}
+		req.URL.RawQuery = query.Encode()
+	}
+	req.Header = op.header.Clone()
+
+	return &HTTPRequest{Request: req, CachedBody: op.body, Name: op.ID, Tags: op.Tags}, nil
+}
+
+// ParseOpenAPI reads an OpenAPI 3 or Swagger 2.0 specification in JSON or YAML.
+func ParseOpenAPI(data []byte) (*OpenAPISpec, error) {
+	var raw any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid specification: %w", err)
+	}
+	doc, ok := normalizeYAML(raw).(map[string]any)
+	if !ok {
+		return nil, errors.New("invalid specification: not an object")
+	}
+
+	p := &openAPIParser{doc: doc, expanding: make(map[string]bool)}
+	switch version, _ := doc["openapi"].(string); {
+	case strings.HasPrefix(version, "3."):
+	case fmt.Sprint(doc["swagger"]) == "2.0":
+		p.swagger2 = true
+	default:
+		return nil, errors.New("only OpenAPI 3 and Swagger 2.0 specifications are supported")
+	}
+
+	spec := &OpenAPISpec{Servers: p.servers()}
+	if info, ok := doc["info"].(map[string]any); ok {
+		spec.Title, _ = info["title"].(string)
+	}
+
+	paths, _ := doc["paths"].(map[string]any)
+	for _, path := range sortedKeys(paths) {
+		item := p.resolve(paths[path])
+		if item == nil {
+			continue
+		}
+		for _, method := range openAPIMethods {
+			operation, ok := item[method].(map[string]any)
+			if !ok {
+				continue
+			}
+			op, err := p.operation(path, method, item, operation)
+			if err != nil {
+				return nil, err
+			}
+			spec.Operations = append(spec.Operations, op)
+		}
+	}
+
+	if len(spec.Operations) == 0 {
+		return nil, errors.New("specification has no operations")
+	}
+
+	return spec, nil
+}
+
+type openAPIParser struct {
+	doc      map[string]any
+	swagger2 bool
+	// refs being expanded by sample, to stop at recursive schemas
+	expanding map[string]bool
+}
+
+// IsAbsoluteServerURL reports whether a server URL names a host. Specs may
+// give servers relative to where they are served from, like /v1, and Swagger
+// 2.0 files may leave out the host.
+func IsAbsoluteServerURL(serverURL string) bool {
+	parsed, err := url.Parse(serverURL)
+	return err == nil && parsed.Host != ""
+}
+
+func (p *openAPIParser) servers() []string {
+	if p.swagger2 {
+		host, _ := p.doc["host"].(string)
+		basePath, _ := p.doc["basePath"].(string)
+		if host == "" {
+			return []string{basePath}
+		}
+		scheme := "https"
+		if schemes, ok := p.doc["schemes"].([]any); ok && len(schemes) > 0 {
+			scheme = fmt.Sprint(schemes[0])
+		}
+		return []string{scheme + "://" + host + basePath}
+	}
+
+	var servers []string
+	list, _ := p.doc["servers"].([]any)
+	for _, item := range list {
+		server, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		serverURL, _ := server["url"].(string)
+		variables, _ := server["variables"].(map[string]any)
+		for name, variable := range variables {
+			if variable, ok := variable.(map[string]any); ok {
+				serverURL = strings.ReplaceAll(serverURL, "{"+name+"}", fmt.Sprint(variable["default"]))
+			}
+		}
+		servers = append(servers, serverURL)
+	}
+	return servers
+}
+
+func (p *openAPIParser) operation(path, method string, item, operation map[string]any) (*OpenAPIOperation, error) {
+	op := &OpenAPIOperation{
+		Method: strings.ToUpper(method),
+		Path:   path,
+		path:   path,
+		query:  url.Values{},
+		header: make(http.Header),
+	}
+	op.ID, _ = operation["operationId"].(string)
+	if op.ID == "" {
+		op.ID = op.Method + " " + path
+	}
+	op.Summary, _ = operation["summary"].(string)
+	if tags, ok := operation["tags"].([]any); ok {
+		for _, tag := range tags {
+			op.Tags = append(op.Tags, fmt.Sprint(tag))
+		}
+	}
+
+	// Operation parameters override path item parameters with the same name.
+	params := make(map[string]map[string]any)
+	var order []string
+	for _, list := range []any{item["parameters"], operation["parameters"]} {
+		items, _ := list.([]any)
+		for _, raw := range items {
+			param := p.resolve(raw)
+			if param == nil {
+				continue
+			}
+			key := fmt.Sprint(param["in"]) + ":" + fmt.Sprint(param["name"])
+			if _, exists := params[key]; !exists {
+				order = append(order, key)
+			}
+			params[key] = param
+		}
+	}
+
+	form := url.Values{}
+	for _, key := range order {
+		param := params[key]
+		name, _ := param["name"].(string)
+		in, _ := param["in"].(string)
+		required, _ := param["required"].(bool)
+		value, explicit := p.paramValue(param)
+
+		switch in {
+		case "path":
+			op.path = strings.ReplaceAll(op.path, "{"+name+"}", url.PathEscape(formatParam(value)))
+		case "query":
+			if required || explicit {
+				if list, ok := value.([]any); ok {
+					for _, v := range list {
+						op.query.Add(name, formatParam(v))
+					}
+				} else {
+					op.query.Add(name, formatParam(value))
+				}
+			}
+		case "header":
+			switch strings.ToLower(name) {
+			case "accept", "content-type", "authorization":
+				// Not allowed as parameters by the specification.
+			default:
+				if required || explicit {
+					op.header.Set(name, formatParam(value))
+				}
+			}
+		case "cookie":
+			if required || explicit {
+				op.header.Add("Cookie", name+"="+formatParam(value))
+			}
+		case "body":
+			schema, _ := param["schema"].(map[string]any)
+			body, err := json.Marshal(p.sample(schema, 0))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", op.ID, err)
+			}
+			op.body = body
+			op.header.Set("Content-Type", p.swaggerConsumes(operation, "application/json"))
+		case "formData":
+			if required || explicit {
+				form.Add(name, formatParam(value))
+			}
+		}
+	}
+	if len(form) > 0 {
+		op.body = []byte(form.Encode())
+		op.header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	if requestBody := p.resolve(operation["requestBody"]); requestBody != nil {
+		if err := p.requestBody(op, requestBody); err != nil {
+			return nil, fmt.Errorf("%s: %w", op.ID, err)
+		}
+	}
+
+	return op, nil
+}
+
+func (p *openAPIParser) swaggerConsumes(operation map[string]any, fallback string) string {
+	for _, source := range []any{operation["consumes"], p.doc["consumes"]} {
+		if list, ok := source.([]any); ok && len(list) > 0 {
+			return fmt.Sprint(list[0])
+		}
+	}
+	return fallback
+}
+
+func (p *openAPIParser) requestBody(op *OpenAPIOperation, requestBody map[string]any) error {
+	content, _ := requestBody["content"].(map[string]any)
+	if len(content) == 0 {
+		return nil
+	}
+
+	mediaTypes := sortedKeys(content)
+	mediaType := mediaTypes[0]
+	for _, candidate := range mediaTypes {
+		if strings.Contains(candidate, "json") {
+			mediaType = candidate
+			break
+		}
+		if candidate == "application/x-www-form-urlencoded" {
+			mediaType = candidate
+		}
+	}
+	media, _ := content[mediaType].(map[string]any)
+
+	value, ok := media["example"]
+	if !ok {
+		if examples, _ := media["examples"].(map[string]any); len(examples) > 0 {
+			example := p.resolve(examples[sortedKeys(examples)[0]])
+			value, ok = example["value"]
+		}
+	}
+	if !ok {
+		schema, _ := media["schema"].(map[string]any)
+		value = p.sample(schema, 0)
+	}
+
+	if strings.Contains(mediaType, "*") {
+		mediaType = "application/json"
+	}
+
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		form := url.Values{}
+		if fields, ok := value.(map[string]any); ok {
+			for _, key := range sortedKeys(fields) {
+				form.Set(key, formatParam(fields[key]))
+			}
+		}
+		op.body = []byte(form.Encode())
+	case strings.HasPrefix(mediaType, "text/"):
+		op.body = []byte(formatParam(value))
+	default:
+		body, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		op.body = body
+	}
+	op.header.Set("Content-Type", mediaType)
+
+	return nil
+}
+
+// paramValue returns the value for a parameter, explicit is false when it was
+// generated from the schema instead of taken from an example.
+func (p *openAPIParser) paramValue(param map[string]any) (value any, explicit bool) {
+	if value, ok := param["example"]; ok {
+		return value, true
+	}
+	if examples, _ := param["examples"].(map[string]any); len(examples) > 0 {
+		if example := p.resolve(examples[sortedKeys(examples)[0]]); example != nil {
+			if value, ok := example["value"]; ok {
+				return value, true
+			}
+		}
+	}
+
+	schema, _ := param["schema"].(map[string]any)
+	if p.swagger2 && schema == nil {
+		// Swagger 2.0 keeps the schema fields on the parameter itself.
+		schema = param
+	}
+	schema = p.resolve(schema)
+	if schema != nil {
+		if value, ok := schema["example"]; ok {
+			return value, true
+		}
+		if value, ok := schema["default"]; ok {
+			return value, true
+		}
+	}
+	return p.sample(schema, 0), false
+}
+
+// sample generates a value that matches schema, preferring examples and
+// defaults of the schema and its properties.
+func (p *openAPIParser) sample(schema map[string]any, depth int) any {
+	if ref, ok := schema["$ref"].(string); ok {
+		if p.expanding[ref] {
+			return nil
+		}
+		p.expanding[ref] = true
+		defer delete(p.expanding, ref)
+	}
+
+	schema = p.resolve(schema)
+	if schema == nil || depth > OPENAPI_MAX_SAMPLE_DEPTH {
+		return nil
+	}
+
+	if value, ok := schema["example"]; ok {
+		return value
+	}
+	if value, ok := schema["default"]; ok {
+		return value
+	}
+	if enum, ok := schema["enum"].([]any); ok && len(enum) > 0 {
+		return enum[0]
+	}
+
+	if allOf, ok := schema["allOf"].([]any); ok {
+		merged := make(map[string]any)
+		for _, part := range allOf {
+			sub, _ := part.(map[string]any)
+			if fields, ok := p.sample(sub, depth+1).(map[string]any); ok {
+				for key, value := range fields {
+					merged[key] = value
+				}
+			}
+		}
+		return merged
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if list, ok := schema[key].([]any); ok && len(list) > 0 {
+			sub, _ := list[0].(map[string]any)
+			return p.sample(sub, depth+1)
+		}
+	}
+
+	switch schemaType(schema) {
+	case "object":
+		object := make(map[string]any)
+		properties, _ := schema["properties"].(map[string]any)
+		for name, property := range properties {
+			sub, _ := property.(map[string]any)
+			if resolved := p.resolve(sub); resolved != nil && resolved["readOnly"] == true {
+				continue
+			}
+			if value := p.sample(sub, depth+1); value != nil {
+				object[name] = value
+			}
+		}
+		return object
+	case "array":
+		items, _ := schema["items"].(map[string]any)
+		if items == nil {
+			return []any{}
+		}
+		if value := p.sample(items, depth+1); value != nil {
+			return []any{value}
+		}
+		return []any{}
+	case "integer":
+		if minimum, ok := schema["minimum"]; ok {
+			return minimum
+		}
+		return 1
+	case "number":
+		if minimum, ok := schema["minimum"]; ok {
+			return minimum
+		}
+		return 1.5
+	case "boolean":
+		return true
+	case "string":
+		switch schema["format"] {
+		case "date-time":
+			return "2024-01-01T00:00:00Z"
+		case "date":
+			return "2024-01-01"
+		case "email":
+			return "user@example.com"
+		case "uuid":
+			return "00000000-0000-0000-0000-000000000001"
+		case "uri", "url":
+			return "https://example.com"
+		case "ipv4":
+			return "127.0.0.1"
+		}
+		return "string"
+	}
+	return nil
+}
+
+func schemaType(schema map[string]any) string {
+	switch t := schema["type"].(type) {
+	case string:
+		return t
+	case []any:
+		// OpenAPI 3.1 allows a list of types, like [string, "null"]
+		for _, item := range t {
+			if s, ok := item.(string); ok && s != "null" {
+				return s
+			}
+		}
+	}
+	if _, ok := schema["properties"]; ok {
+		return "object"
+	}
+	if _, ok := schema["items"]; ok {
+		return "array"
+	}
+	return ""
+}
+
+// resolve follows local $ref pointers like #/components/schemas/Pet, refs to
+// other files are not supported and resolve to nil.
+func (p *openAPIParser) resolve(node any) map[string]any {
+	object, _ := node.(map[string]any)
+	for hops := 0; object != nil; hops++ {
+		ref, ok := object["$ref"].(string)
+		if !ok {
+			return object
+		}
+		if hops >= OPENAPI_MAX_REF_HOPS || !strings.HasPrefix(ref, "#/") {
+			return nil
+		}
+
+		var current any = p.doc
+		for _, part := range strings.Split(ref[2:], "/") {
+			part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+			if unescaped, err := url.PathUnescape(part); err == nil {
+				part = unescaped
+			}
+			parent, ok := current.(map[string]any)
+			if !ok {
+				return nil
+			}
+			current = parent[part]
+		}
+		object, _ = current.(map[string]any)
+	}
+	return nil
+}
+
+func formatParam(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]any, []any:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return fmt.Sprint(value)
+}
+
+// normalizeYAML converts the maps yaml produces for non-string keys, like
+// response codes, into map[string]any so the document can be walked and
+// encoded as JSON.
+func normalizeYAML(node any) any {
+	switch v := node.(type) {
+	case map[string]any:
+		for key, value := range v {
+			v[key] = normalizeYAML(value)
+		}
+		return v
+	case map[any]any:
+		object := make(map[string]any, len(v))
+		for key, value := range v {
+			object[fmt.Sprint(key)] = normalizeYAML(value)
+		}
+		return object
+	case []any:
+		for i, value := range v {
+			v[i] = normalizeYAML(value)
+		}
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+	return node
+}
+
+func sortedKeys(object map[string]any) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,471 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	POSTMAN_GROUP_SEPARATOR = " / "
+)
+
+var postmanVariable = regexp.MustCompile(`{{\s*([^{}\s]+)\s*}}`)
+
+// PostmanImport is the result of a collection import. Warnings list the
+// parts that could not be imported, like file uploads or unknown variables.
+type PostmanImport struct {
+	Name     string
+	Requests []*HTTPRequest
+	Warnings []string
+}
+
+type postmanCollection struct {
+	Info struct {
+		Name   string `json:"name"`
+		Schema string `json:"schema"`
+	} `json:"info"`
+	Item     []postmanItem     `json:"item"`
+	Variable []postmanKeyValue `json:"variable"`
+	Auth     *postmanAuth      `json:"auth"`
+}
+
+type postmanItem struct {
+	Name    string          `json:"name"`
+	Item    []postmanItem   `json:"item"`
+	Request json.RawMessage `json:"request"`
+	Auth    *postmanAuth    `json:"auth"`
+}
+
+type postmanRequest struct {
+	Method string            `json:"method"`
+	URL    json.RawMessage   `json:"url"`
+	Header []postmanKeyValue `json:"header"`
+	Body   *struct {
+		Mode       string            `json:"mode"`
+		Raw        string            `json:"raw"`
+		URLEncoded []postmanKeyValue `json:"urlencoded"`
+		FormData   []postmanKeyValue `json:"formdata"`
+		GraphQL    *struct {
+			Query     string `json:"query"`
+			Variables string `json:"variables"`
+		} `json:"graphql"`
+		Options struct {
+			Raw struct {
+				Language string `json:"language"`
+			} `json:"raw"`
+		} `json:"options"`
+	} `json:"body"`
+	Auth *postmanAuth `json:"auth"`
+}
+
+type postmanAuth struct {
+	Type   string            `json:"type"`
+	Basic  []postmanKeyValue `json:"basic"`
+	Bearer []postmanKeyValue `json:"bearer"`
+	APIKey []postmanKeyValue `json:"apikey"`
+}
+
+type postmanKeyValue struct {
+	Key      string `json:"key"`
+	Value    any    `json:"value"`
+	Type     string `json:"type"`
+	Disabled bool   `json:"disabled"`
+	Enabled  *bool  `json:"enabled"`
+}
+
+func (kv postmanKeyValue) value() string {
+	if kv.Value == nil {
+		return ""
+	}
+	if s, ok := kv.Value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(kv.Value)
+}
+
+func (kv postmanKeyValue) active() bool {
+	return !kv.Disabled && (kv.Enabled == nil || *kv.Enabled)
+}
+
+// ParsePostmanEnvironment reads the enabled variables of an exported Postman
+// environment.
+func ParsePostmanEnvironment(r io.Reader) (map[string]string, error) {
+	var env struct {
+		Values []postmanKeyValue `json:"values"`
+	}
+	if err := json.NewDecoder(r).Decode(&env); err != nil {
+		return nil, fmt.Errorf("invalid Postman environment: %w", err)
+	}
+	if env.Values == nil {
+		return nil, errors.New("invalid Postman environment: no values")
+	}
+
+	vars := make(map[string]string, len(env.Values))
+	for _, kv := range env.Values {
+		if kv.active() {
+			vars[kv.Key] = kv.value()
+		}
+	}
+	return vars, nil
+}
+
+// ImportPostman reads a Postman v2.1 collection. Folders become request
+// groups, env overrides the collection variables and :name path segments
+// get the values of the URL variables.
+func ImportPostman(r io.Reader, env map[string]string) (*PostmanImport, error) {
+	var collection postmanCollection
+	if err := json.NewDecoder(r).Decode(&collection); err != nil {
+		return nil, fmt.Errorf("invalid Postman collection: %w", err)
+	}
+	if collection.Item == nil {
+		return nil, errors.New("invalid Postman collection: no items")
+	}
+	// v2.0 differs in auth and variables, Postman exports both.
+	if schema := collection.Info.Schema; schema != "" && !strings.Contains(schema, "v2.1") {
+		return nil, fmt.Errorf("unsupported Postman collection format %s, export it as v2.1", schema)
+	}
+
+	vars := make(map[string]string)
+	for _, kv := range collection.Variable {
+		if kv.active() {
+			vars[kv.Key] = kv.value()
+		}
+	}
+	for key, value := range env {
+		vars[key] = value
+	}
+
+	imp := &postmanImporter{
+		vars:       vars,
+		unresolved: make(map[string]bool),
+		result:     &PostmanImport{Name: collection.Info.Name},
+	}
+	imp.items(collection.Item, "", collection.Auth)
+
+	unresolved := make([]string, 0, len(imp.unresolved))
+	for name := range imp.unresolved {
+		unresolved = append(unresolved, name)
+	}
+	sort.Strings(unresolved)
+	for _, name := range unresolved {
+		imp.warn("", fmt.Sprintf("variable {{%s}} is not defined", name))
+	}
+	if len(imp.result.Requests) == 0 {
+		return nil, errors.New("collection has no requests that can be imported")
+	}
+
+	return imp.result, nil
+}
+
+type postmanImporter struct {
+	vars       map[string]string
+	unresolved map[string]bool
+	result     *PostmanImport
+}
+
+func (imp *postmanImporter) warn(name, message string) {
+	if name != "" {
+		message = name + ": " + message
+	}
+	imp.result.Warnings = append(imp.result.Warnings, message)
+}
+
+func (imp *postmanImporter) items(items []postmanItem, group string, auth *postmanAuth) {
+	for _, item := range items {
+		itemAuth := auth
+		if item.Auth != nil && item.Auth.Type != "inherit" {
+			itemAuth = item.Auth
+		}
+
+		if item.Request == nil {
+			subgroup := item.Name
+			if group != "" {
+				subgroup = group + POSTMAN_GROUP_SEPARATOR + item.Name
+			}
+			imp.items(item.Item, subgroup, itemAuth)
+			continue
+		}
+
+		req, err := imp.request(item, group, itemAuth)
+		if err != nil {
+			imp.warn(item.Name, err.Error())
+			continue
+		}
+		imp.result.Requests = append(imp.result.Requests, req)
+	}
+}
+
+func (imp *postmanImporter) request(item postmanItem, group string, auth *postmanAuth) (*HTTPRequest, error) {
+	var pr postmanRequest
+	// A request can also be just its URL.
+	var rawURL string
+	if err := json.Unmarshal(item.Request, &rawURL); err == nil {
+		pr.Method = http.MethodGet
+		pr.URL, _ = json.Marshal(rawURL)
+	} else if err := json.Unmarshal(item.Request, &pr); err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+
+	if pr.Auth != nil && pr.Auth.Type != "inherit" {
+		auth = pr.Auth
+	}
+
+	rawURL, err := imp.url(pr.URL, item.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	protocol := HTTP
+	if rawURL, err = ValidateURL(rawURL, &protocol); err != nil {
+		return nil, err
+	}
+
+	header := make(http.Header)
+	for _, h := range pr.Header {
+		if h.active() {
+			header.Add(imp.substitute(h.Key), imp.substitute(h.value()))
+		}
+	}
+
+	body, contentType, err := imp.body(&pr, item.Name)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" && header.Get("Content-Type") == "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	method := strings.ToUpper(pr.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequest(method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if host := header.Get("Host"); host != "" {
+		req.Host = host
+		header.Del("Host")
+	}
+	req.Header = header
+
+	if err := imp.auth(req, auth); err != nil {
+		imp.warn(item.Name, err.Error())
+	}
+
+	return &HTTPRequest{Request: req, CachedBody: body, Name: item.Name, Group: group}, nil
+}
+
+func (imp *postmanImporter) url(raw json.RawMessage, name string) (string, error) {
+	var rawURL string
+	if err := json.Unmarshal(raw, &rawURL); err == nil {
+		return imp.substitute(imp.pathVariables(rawURL, nil, name)), nil
+	}
+
+	var parts struct {
+		Raw      string            `json:"raw"`
+		Protocol string            `json:"protocol"`
+		Host     []string          `json:"host"`
+		Port     string            `json:"port"`
+		Path     []string          `json:"path"`
+		Query    []postmanKeyValue `json:"query"`
+		Variable []postmanKeyValue `json:"variable"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	if parts.Raw != "" {
+		return imp.substitute(imp.pathVariables(parts.Raw, parts.Variable, name)), nil
+	}
+	if len(parts.Host) == 0 {
+		return "", errors.New("request has no URL")
+	}
+
+	rawURL = strings.Join(parts.Host, ".")
+	if parts.Protocol != "" {
+		rawURL = parts.Protocol + "://" + rawURL
+	}
+	if parts.Port != "" {
+		rawURL += ":" + parts.Port
+	}
+	if len(parts.Path) > 0 {
+		rawURL += "/" + strings.Join(parts.Path, "/")
+	}
+	query := url.Values{}
+	for _, kv := range parts.Query {
+		if kv.active() {
+			query.Add(kv.Key, kv.value())
+		}
+	}
+	if len(query) > 0 {
+		rawURL += "?" + query.Encode()
+	}
+
+	return imp.substitute(imp.pathVariables(rawURL, parts.Variable, name)), nil
+}
+
+// pathVariables replaces :name segments of the path with the values of the
+// URL variables, segments without a value are left and reported.
+func (imp *postmanImporter) pathVariables(rawURL string, variables []postmanKeyValue, name string) string {
+	start := 0
+	if i := strings.Index(rawURL, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	slash := strings.Index(rawURL[start:], "/")
+	if slash < 0 {
+		return rawURL
+	}
+	start += slash
+	end := len(rawURL)
+	if i := strings.IndexAny(rawURL[start:], "?#"); i >= 0 {
+		end = start + i
+	}
+
+	values := make(map[string]string, len(variables))
+	for _, kv := range variables {
+		if kv.value() != "" {
+			values[kv.Key] = kv.value()
+		}
+	}
+	segments := strings.Split(rawURL[start:end], "/")
+	for i, segment := range segments {
+		if len(segment) < 2 || segment[0] != ':' {
+			continue
+		}
+		if value, ok := values[segment[1:]]; ok {
+			segments[i] = value
+		} else {
+			imp.warn(name, fmt.Sprintf("path variable %s has no value", segment))
+		}
+	}
+	return rawURL[:start] + strings.Join(segments, "/") + rawURL[end:]
+}
+
+func (imp *postmanImporter) body(pr *postmanRequest, name string) ([]byte, string, error) {
+	if pr.Body == nil {
+		return nil, "", nil
+	}
+
+	switch pr.Body.Mode {
+	case "", "none":
+		return nil, "", nil
+	case "raw":
+		contentType := ""
+		switch pr.Body.Options.Raw.Language {
+		case "json":
+			contentType = "application/json"
+		case "xml":
+			contentType = "application/xml"
+		case "html":
+			contentType = "text/html"
+		case "javascript":
+			contentType = "application/javascript"
+		case "text":
+			contentType = "text/plain"
+		}
+		return []byte(imp.substitute(pr.Body.Raw)), contentType, nil
+	case "urlencoded":
+		form := url.Values{}
+		for _, kv := range pr.Body.URLEncoded {
+			if kv.active() {
+				form.Add(imp.substitute(kv.Key), imp.substitute(kv.value()))
+			}
+		}
+		return []byte(form.Encode()), "application/x-www-form-urlencoded", nil
+	case "formdata":
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		for _, kv := range pr.Body.FormData {
+			if !kv.active() {
+				continue
+			}
+			if kv.Type == "file" {
+				imp.warn(name, fmt.Sprintf("file field %q skipped", kv.Key))
+				continue
+			}
+			if err := writer.WriteField(imp.substitute(kv.Key), imp.substitute(kv.value())); err != nil {
+				return nil, "", err
+			}
+		}
+		if err := writer.Close(); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), writer.FormDataContentType(), nil
+	case "graphql":
+		if pr.Body.GraphQL == nil {
+			return nil, "", nil
+		}
+		payload := map[string]any{"query": imp.substitute(pr.Body.GraphQL.Query)}
+		if variables := strings.TrimSpace(imp.substitute(pr.Body.GraphQL.Variables)); variables != "" {
+			payload["variables"] = json.RawMessage(variables)
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid GraphQL variables: %w", err)
+		}
+		return body, "application/json", nil
+	}
+
+	return nil, "", fmt.Errorf("body mode %q is not supported", pr.Body.Mode)
+}
+
+func (imp *postmanImporter) auth(req *http.Request, auth *postmanAuth) error {
+	if auth == nil {
+		return nil
+	}
+
+	param := func(list []postmanKeyValue, key string) string {
+		for _, kv := range list {
+			if kv.Key == key {
+				return imp.substitute(kv.value())
+			}
+		}
+		return ""
+	}
+
+	switch auth.Type {
+	case "noauth", "inherit":
+	case "basic":
+		credentials := param(auth.Basic, "username") + ":" + param(auth.Basic, "password")
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	case "bearer":
+		req.Header.Set("Authorization", "Bearer "+param(auth.Bearer, "token"))
+	case "apikey":
+		key, value := param(auth.APIKey, "key"), param(auth.APIKey, "value")
+		if param(auth.APIKey, "in") == "query" {
+			query := req.URL.Query()
+			query.Set(key, value)
+			req.URL.RawQuery = query.Encode()
+		} else {
+			req.Header.Set(key, value)
+		}
+	default:
+		return fmt.Errorf("auth type %q is not supported, configure it in the Authentication window", auth.Type)
+	}
+	return nil
+}
+
+// substitute replaces {{variables}}, unknown ones are left as they are and
+// reported once.
+func (imp *postmanImporter) substitute(text string) string {
+	return postmanVariable.ReplaceAllStringFunc(text, func(match string) string {
+		name := postmanVariable.FindStringSubmatch(match)[1]
+		if value, ok := imp.vars[name]; ok {
+			return value
+		}
+		imp.unresolved[name] = true
+		return match
+	})
+}
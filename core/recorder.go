@@ -0,0 +1,354 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_RECORDER_ADDR     = "127.0.0.1:8091"
+	MAX_RECORDED_BODY_SIZE    = 10 << 20
+	MAX_RECORDED_REQUESTS     = 10000
+	RECORDER_SHUTDOWN_TIMEOUT = 5 * time.Second
+)
+
+const RECORDER_HELP = `TestYourServer recorder
+
+Set %s as the HTTP proxy of a browser or client, or start the recorder with
+a target to send requests to it directly. Plain HTTP requests are recorded,
+HTTPS through the proxy is passed on without being recorded.
+`
+
+// hopHeaders are meant for the proxy, not for the server.
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Connection", "Proxy-Authorization", "Proxy-Authenticate",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade", "Content-Length",
+}
+
+// RecorderConfig configures the recording proxy. Without a Target it is a
+// forward proxy, with one every request it gets is sent to the Target.
+type RecorderConfig struct {
+	Addr   string
+	Target string
+}
+
+// RecordedRequest is one request that went through the recorder.
+type RecordedRequest struct {
+	Time        time.Time
+	Method      string
+	URL         string
+	Header      http.Header
+	Body        []byte
+	Status      int
+	ContentType string
+	Duration    time.Duration
+	Err         string
+	// BodyTruncated is set when the body was larger than
+	// MAX_RECORDED_BODY_SIZE, such requests aren't turned into steps.
+	BodyTruncated bool
+}
+
+// Recorder forwards requests to the real server and records them, so they
+// can be turned into a scenario with Steps or saved with WriteHAR.
+type Recorder struct {
+	cfg      RecorderConfig
+	target   *url.URL
+	server   *http.Server
+	listener net.Listener
+	proxy    *httputil.ReverseProxy
+
+	mu       sync.Mutex
+	records  []RecordedRequest
+	skipped  int
+	tunneled map[string]int
+}
+
+type recordKey struct{}
+
+// StartRecorder listens on cfg.Addr and records in the background until
+// Close.
+func StartRecorder(cfg RecorderConfig) (*Recorder, error) {
+	if cfg.Addr == "" {
+		cfg.Addr = DEFAULT_RECORDER_ADDR
+	}
+
+	rec := &Recorder{cfg: cfg, tunneled: make(map[string]int)}
+	if cfg.Target != "" {
+		protocol := HTTP
+		target, err := ValidateURL(cfg.Target, &protocol)
+		if err != nil {
+			return nil, fmt.Errorf("recorder target: %w", err)
+		}
+		rec.cfg.Target = target
+		rec.target, _ = url.Parse(target)
+	}
+
+	listener, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	rec.listener = listener
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	rec.proxy = &httputil.ReverseProxy{
+		Rewrite:        rec.rewrite,
+		Transport:      transport,
+		ModifyResponse: rec.response,
+		ErrorHandler:   rec.failed,
+	}
+	rec.server = &http.Server{Handler: http.HandlerFunc(rec.handle), ReadHeaderTimeout: REQUEST_TIMEOUT}
+
+	go func() {
+		if err := rec.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Println("recorder stopped:", err)
+		}
+	}()
+
+	return rec, nil
+}
+
+// URL is the address to set as the proxy or to send requests to.
+func (rec *Recorder) URL() string {
+	return "http://" + rec.listener.Addr().String()
+}
+
+func (rec *Recorder) Target() string {
+	return rec.cfg.Target
+}
+
+func (rec *Recorder) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), RECORDER_SHUTDOWN_TIMEOUT)
+	defer cancel()
+
+	// Shutdown doesn't wait for hijacked CONNECT tunnels, they end when the
+	// client leaves.
+	return rec.server.Shutdown(ctx)
+}
+
+func (rec *Recorder) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		rec.tunnel(w, r)
+		return
+	}
+	// A proxy request for the recorder itself would loop.
+	proxied := r.URL.IsAbs() && r.URL.Host != rec.listener.Addr().String()
+	if !proxied && rec.target == nil {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, RECORDER_HELP, rec.URL())
+		return
+	}
+
+	record := &RecordedRequest{Time: time.Now(), Method: r.Method, Header: r.Header.Clone()}
+	for _, name := range hopHeaders {
+		record.Header.Del(name)
+	}
+
+	body := &recordedBody{ReadCloser: r.Body}
+	r.Body = body
+	rec.proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), recordKey{}, record)))
+
+	record.Duration = time.Since(record.Time)
+	record.Body = body.buf.Bytes()
+	record.BodyTruncated = body.truncated
+	rec.add(record)
+}
+
+func (rec *Recorder) rewrite(pr *httputil.ProxyRequest) {
+	out := pr.Out.URL
+	if rec.target != nil {
+		out.Scheme, out.Host = rec.target.Scheme, rec.target.Host
+		pr.Out.Host = ""
+	}
+	if record, ok := pr.In.Context().Value(recordKey{}).(*RecordedRequest); ok {
+		record.URL = out.String()
+	}
+}
+
+func (rec *Recorder) response(resp *http.Response) error {
+	if record, ok := resp.Request.Context().Value(recordKey{}).(*RecordedRequest); ok {
+		record.Status = resp.StatusCode
+		record.ContentType = resp.Header.Get("Content-Type")
+	}
+	return nil
+}
+
+func (rec *Recorder) failed(w http.ResponseWriter, r *http.Request, err error) {
+	if record, ok := r.Context().Value(recordKey{}).(*RecordedRequest); ok {
+		record.Err = err.Error()
+	}
+	http.Error(w, err.Error(), http.StatusBadGateway)
+}
+
+func (rec *Recorder) add(record *RecordedRequest) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if len(rec.records) >= MAX_RECORDED_REQUESTS {
+		rec.skipped++
+		return
+	}
+	rec.records = append(rec.records, *record)
+}
+
+// tunnel passes HTTPS through unchanged, it can't be read without breaking
+// the encryption.
+func (rec *Recorder) tunnel(w http.ResponseWriter, r *http.Request) {
+	rec.mu.Lock()
+	rec.tunneled[r.Host]++
+	rec.mu.Unlock()
+
+	upstream, err := net.DialTimeout("tcp", r.Host, REQUEST_TIMEOUT)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "tunneling is not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		conn.Close()
+		upstream.Close()
+		return
+	}
+
+	go func() {
+		io.Copy(upstream, buffered)
+		upstream.Close()
+	}()
+	io.Copy(conn, upstream)
+	conn.Close()
+}
+
+// Records are the recorded requests in the order they finished.
+func (rec *Recorder) Records() []RecordedRequest {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]RecordedRequest{}, rec.records...)
+}
+
+// Count is the number of recorded requests, skipped ones came after
+// MAX_RECORDED_REQUESTS.
+func (rec *Recorder) Count() (recorded, skipped int) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return len(rec.records), rec.skipped
+}
+
+// Tunneled are the hosts of the HTTPS connections that were passed on
+// without being recorded.
+func (rec *Recorder) Tunneled() []string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	hosts := make([]string, 0, len(rec.tunneled))
+	for host := range rec.tunneled {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+func (rec *Recorder) Clear() {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.records = nil
+	rec.skipped = 0
+	clear(rec.tunneled)
+}
+
+// Steps turns the matching records into a scenario in the order they were
+// sent, with the original pauses between them like ImportHAR.
+func (rec *Recorder) Steps(filter HARFilter) ([]ScenarioStep, error) {
+	records := rec.Records()
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+
+	var steps []ScenarioStep
+	var prevStarted time.Time
+	for _, record := range records {
+		if record.BodyTruncated {
+			continue
+		}
+		parsedURL, err := url.Parse(record.URL)
+		if err != nil || !filter.match(parsedURL.Hostname(), record.ContentType) {
+			continue
+		}
+
+		req, err := record.request(filter.DropCookies)
+		if err != nil {
+			return nil, fmt.Errorf("request %s %s: %w", record.Method, record.URL, err)
+		}
+
+		step := ScenarioStep{Request: req}
+		if len(steps) > 0 {
+			step.Delay = max(record.Time.Sub(prevStarted), 0)
+		}
+		prevStarted = record.Time
+		steps = append(steps, step)
+	}
+
+	if len(steps) == 0 {
+		return nil, errors.New("no recorded requests match the filter")
+	}
+	return steps, nil
+}
+
+func (record *RecordedRequest) request(dropCookies bool) (*HTTPRequest, error) {
+	req, err := http.NewRequest(record.Method, record.URL, bytes.NewReader(record.Body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = record.Header.Clone()
+	// Like ImportHAR, the transport only decodes what it asked for.
+	req.Header.Del("Accept-Encoding")
+	if dropCookies {
+		req.Header.Del("Cookie")
+	}
+
+	var body []byte
+	if len(record.Body) > 0 {
+		body = record.Body
+	}
+	return &HTTPRequest{Request: req, CachedBody: body}, nil
+}
+
+// recordedBody keeps a copy of the request body while the proxy sends it.
+type recordedBody struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (b *recordedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if room := MAX_RECORDED_BODY_SIZE - b.buf.Len(); n > room {
+		b.buf.Write(p[:room])
+		b.truncated = true
+	} else {
+		b.buf.Write(p[:n])
+	}
+	return n, err
+}
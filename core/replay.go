@@ -0,0 +1,352 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_REPLAY_SPEED = 1.0
+	MAX_REPLAY_SPEED     = 1000.0
+	REPLAY_GROUP         = "Replay"
+	// MAX_REPLAY_BATCH bounds the entries read ahead to spread a second.
+	MAX_REPLAY_BATCH = 100000
+)
+
+var replayIDSegment = regexp.MustCompile(`^([0-9]+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9a-fA-F]{16,})$`)
+
+// ReplayConfig replays an access log instead of sending Requests. Every
+// entry is sent at its original offset from the first one divided by Speed,
+// Count_Workers caps the requests in flight. The test ends after the last
+// entry or after Duration.
+type ReplayConfig struct {
+	// Path of the log, Common/Combined Log Format or JSON Lines, gzip when it
+	// ends with .gz.
+	Path string
+	// Target replaces scheme and host of the logged requests, like
+	// http://staging:8080. Without it entries need an absolute URL or a host.
+	Target string
+	// Speed 2 replays twice as fast, 0 means 1.
+	Speed float64
+}
+
+// ReplayReport summarizes the log of a replayed test.
+type ReplayReport struct {
+	Path    string
+	Target  string
+	Speed   float64
+	Entries int
+	// Skipped lines couldn't be parsed or turned into a request.
+	Skipped int
+	// Span is the time between the first and the last replayed entry in the
+	// log.
+	Span time.Duration
+	// Err is why the replay stopped before the end of the log.
+	Err string
+}
+
+func checkReplayConfig(cfg *ReplayConfig, protocol Protocol) error {
+	if cfg.Path == "" {
+		return errors.New("replay needs the path of an access log")
+	}
+	if protocol != HTTP {
+		return errors.New("Replay is only supported for HTTP")
+	}
+	if cfg.Speed < 0 || cfg.Speed > MAX_REPLAY_SPEED {
+		return fmt.Errorf("replay speed must be between 0 and %v, got %v", MAX_REPLAY_SPEED, cfg.Speed)
+	}
+	if cfg.Speed == 0 {
+		cfg.Speed = DEFAULT_REPLAY_SPEED
+	}
+	if cfg.Target != "" {
+		target, err := ValidateURL(cfg.Target, &protocol)
+		if err != nil {
+			return fmt.Errorf("replay target: %w", err)
+		}
+		cfg.Target = target
+	}
+	return nil
+}
+
+// replaySource reads the entries with their offset from the first one. Logs
+// with whole seconds put many entries on the same second, those are spread
+// evenly over it instead of being sent in one burst.
+type replaySource struct {
+	log    *AccessLogReader
+	target *url.URL
+	first  time.Time
+	last   time.Time
+	batch  []*AccessLogEntry
+	index  int
+	ahead  *AccessLogEntry
+	// peeked is the first request, read when the log is opened.
+	peeked *HTTPRequest
+
+	entries int
+	// skipped are the entries that aren't requests, the log counts the rest.
+	skipped int
+	samples []string
+}
+
+// openReplay opens the log and reads the first request, so a log without
+// any is an error before the test starts.
+func openReplay(cfg *ReplayConfig) (*replaySource, error) {
+	log, err := OpenAccessLog(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	source := &replaySource{log: log}
+	if cfg.Target != "" {
+		source.target, _ = url.Parse(cfg.Target)
+	}
+	source.peeked, _, err = source.next()
+	if err != nil {
+		log.Close()
+		if err == io.EOF {
+			return nil, source.emptyError()
+		}
+		return nil, err
+	}
+	return source, nil
+}
+
+func (s *replaySource) emptyError() error {
+	skipped, samples := s.skippedLines()
+	if skipped == 0 {
+		return errors.New("the access log has no entries")
+	}
+	return fmt.Errorf("no line of the access log can be replayed, %s", strings.Join(samples, "; "))
+}
+
+// next returns the next request and its offset, io.EOF after the last.
+func (s *replaySource) next() (*HTTPRequest, time.Duration, error) {
+	if req := s.peeked; req != nil {
+		s.peeked = nil
+		return req, 0, nil
+	}
+	for {
+		if s.index >= len(s.batch) {
+			if err := s.fill(); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		entry := s.batch[s.index]
+		if s.entries == 0 {
+			// Offsets count from the first request, not from the first line.
+			s.first = entry.Time
+		}
+		offset := entry.Time.Sub(s.first)
+		if entry.Time.Nanosecond() == 0 && len(s.batch) > 1 {
+			offset += time.Second * time.Duration(s.index) / time.Duration(len(s.batch))
+		}
+		s.index++
+
+		req, err := s.request(entry)
+		if err != nil {
+			s.skipped++
+			if len(s.samples) < MAX_ACCESS_LOG_SKIPPED {
+				s.samples = append(s.samples, fmt.Sprintf("%s %s: %v", entry.Method, entry.URL, err))
+			}
+			continue
+		}
+		s.entries++
+		if entry.Time.After(s.last) {
+			s.last = entry.Time
+		}
+		return req, offset, nil
+	}
+}
+
+// fill reads the entries logged at the same time as the next one.
+func (s *replaySource) fill() error {
+	s.batch, s.index = s.batch[:0], 0
+	for len(s.batch) < MAX_REPLAY_BATCH {
+		entry := s.ahead
+		s.ahead = nil
+		if entry == nil {
+			var err error
+			entry, err = s.log.Next()
+			if err == io.EOF && len(s.batch) > 0 {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(s.batch) > 0 && !entry.Time.Equal(s.batch[0].Time) {
+			s.ahead = entry
+			return nil
+		}
+		s.batch = append(s.batch, entry)
+	}
+	return nil
+}
+
+// request turns an entry into a request named after its endpoint, grouped by
+// the status class it got originally.
+func (s *replaySource) request(entry *AccessLogEntry) (*HTTPRequest, error) {
+	u, err := url.Parse(entry.URL)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case s.target != nil:
+		u.Scheme, u.Host = s.target.Scheme, s.target.Host
+	case u.Host == "" && entry.Host != "":
+		u.Host = entry.Host
+	case u.Host == "":
+		return nil, errors.New("no host, set a replay target")
+	}
+	if u.Scheme == "" {
+		u.Scheme = "http"
+	}
+
+	var body io.Reader
+	if entry.Body != "" {
+		body = strings.NewReader(entry.Body)
+	}
+	req, err := http.NewRequest(entry.Method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range entry.Headers {
+		req.Header.Set(name, value)
+	}
+	for _, name := range []string{"Host", "Content-Length", "Connection", "Transfer-Encoding"} {
+		req.Header.Del(name)
+	}
+	if entry.UserAgent != "" {
+		req.Header.Set("User-Agent", entry.UserAgent)
+	}
+	if entry.Referer != "" {
+		req.Header.Set("Referer", entry.Referer)
+	}
+
+	replayed := &HTTPRequest{
+		Request: req,
+		Name:    req.Method + " " + replayEndpoint(u.Path),
+		Group:   REPLAY_GROUP,
+	}
+	if entry.Status > 0 {
+		replayed.Group = REPLAY_GROUP + ", originally " + strconv.Itoa(entry.Status/100) + "xx"
+	}
+	if entry.Body != "" {
+		replayed.CachedBody = []byte(entry.Body)
+	}
+	return replayed, nil
+}
+
+// replayEndpoint replaces ids in a path, so /users/42 and /users/7 share the
+// report of /users/{id}.
+func replayEndpoint(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if replayIDSegment.MatchString(segment) {
+			segments[i] = "{id}"
+		}
+	}
+	if path = strings.Join(segments, "/"); path == "" {
+		return "/"
+	}
+	return path
+}
+
+func (s *replaySource) skippedLines() (int, []string) {
+	skipped, samples := s.log.Skipped()
+	samples = append(append([]string{}, samples...), s.samples...)
+	return skipped + s.skipped, samples[:min(len(samples), MAX_ACCESS_LOG_SKIPPED)]
+}
+
+func (s *replaySource) close(cfg *ReplayConfig) *ReplayReport {
+	if err := s.log.Close(); err != nil {
+		fmt.Println("failed to close the access log:", err)
+	}
+
+	skipped, samples := s.skippedLines()
+	if skipped > 0 {
+		fmt.Printf("replay skipped %d lines of %s: %s\n", skipped, cfg.Path, strings.Join(samples, "; "))
+	}
+	return &ReplayReport{
+		Path:    cfg.Path,
+		Target:  cfg.Target,
+		Speed:   cfg.Speed,
+		Entries: s.entries,
+		Skipped: skipped,
+		Span:    s.last.Sub(s.first),
+	}
+}
+
+// runReplay sends the entries of the log on their original schedule. The
+// dispatcher waits for a free worker, so when the server or the generator
+// can't keep up the delay shows up as lag. Pauses shift the rest of the log.
+func (e *engine) runReplay(source *replaySource, start time.Time) error {
+	type replayJob struct {
+		req      *HTTPRequest
+		intended time.Time
+	}
+	jobs := make(chan replayJob)
+
+	for id := 0; id < e.cfg.Count_Workers; id++ {
+		sched := newSchedule(start, e.control, nil)
+		auth := e.workerAuth()
+		cl := &http.Client{
+			Transport: e.transports[id%len(e.transports)],
+			Timeout:   REQUEST_TIMEOUT,
+		}
+
+		e.workers.Add(1)
+		go func() {
+			defer e.workers.Done()
+			for job := range jobs {
+				reqInf, ok := e.sendHTTP(e.ctx, id, cl, auth, job.req, sched, job.intended)
+				if !ok {
+					return
+				}
+				e.publish(reqInf)
+			}
+		}()
+	}
+	defer close(jobs)
+
+	speed := e.cfg.Replay.Speed
+	for {
+		req, offset, err := source.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading the access log: %w", err)
+		}
+
+		var intended time.Time
+		for {
+			intended = start.Add(time.Duration(float64(offset)/speed) + e.control.PausedFor())
+			if !sleepUntil(e.ctx, intended) {
+				return nil
+			}
+			waited, ok := e.control.wait(e.ctx)
+			if !ok {
+				return nil
+			}
+			if !waited {
+				break
+			}
+		}
+
+		select {
+		case jobs <- replayJob{req: req, intended: intended}:
+		case <-e.ctx.Done():
+			return nil
+		}
+	}
+}
@@ -1,98 +1,219 @@
 package core
 
 import (
+	"errors"
+	"runtime"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-const (
-	REP_CHAN_BUF_SIZE = 100
-)
-
 type RequestReport struct {
 	Url     string
+	Name    string
+	Group   string
+	Tags    []string
 	AvgTime time.Duration
 	MinTime time.Duration
 	MaxTime time.Duration
 	Count   int
 	ReqCods map[int]int
-	Errors  map[string]int
+	// Errors are keyed by ErrorClass.String(), ProxyErrors by proxy address.
+	Errors      map[string]*ErrorSummary
+	ProxyErrors map[string]int
+	Phases      PhaseReport
+
+	// Latency is the service time measured from the actual send, ResponseTime
+	// is measured from the intended send time and includes the time requests
+	// waited because the worker fell behind schedule. Both in microseconds.
+	Latency         *Histogram
+	ResponseTime    *Histogram
+	AvgResponseTime time.Duration
+	MaxResponseTime time.Duration
+	LateRequests    int
+	MaxLag          time.Duration
+
+	// BodySizes holds the decoded response body sizes in bytes.
+	BytesSent     int64
+	BytesReceived int64
+	BodySizes     *Histogram
+	Started       time.Time
+	Finished      time.Time
 }
 
-func reportPool(in <-chan *RequestInfo) []*RequestReport {
-	reqMap := make(map[Request]struct {
-		ch  chan *RequestInfo
-		rep *RequestReport
-	})
-	result := make([]*RequestReport, 0)
+// TestReport is the result of one test run.
+type TestReport struct {
+	ID         string
+	Started    time.Time
+	Finished   time.Time
+	Paused     time.Duration
+	Config     RunConfig
+	Requests   []*RequestReport
+	TimeSeries []TimeSeriesPoint
+	// Events are the load changes made while the test ran, the first one is
+	// the initial load.
+	Events []LoadEvent
+	// Metrics are recorded by the script with metric().
+	Metrics map[string]*MetricSummary
+	// Dropped results only missed the live preview and other sinks with
+	// DROP_WHEN_FULL, the reports count them.
+	Dropped int64
+	// ResultLog is the file every result was written to, if any.
+	ResultLog string
+	// ResultLogErr is why the result log is incomplete.
+	ResultLogErr string
+	// Replay is set when the test replayed an access log.
+	Replay *ReplayReport
+}
 
-	var calcRepWg sync.WaitGroup
+// RunConfig is the part of RequestsConfig kept with the report.
+type RunConfig struct {
+	Protocol      Protocol
+	Count_Workers int
+	Delay         time.Duration
+	Duration      time.Duration
+	Requests      []string
+}
 
-	for {
-		req, ok := <-in
+type reportSums struct {
+	time         time.Duration
+	responseTime time.Duration
+	dns          time.Duration
+	connect      time.Duration
+	tls          time.Duration
+	ttfb         time.Duration
+	transfer     time.Duration
+}
 
-		if !ok {
-			for _, v := range reqMap {
-				close(v.ch)
-			}
-			calcRepWg.Wait()
+// reportAggregator collects the reports of a test without a channel in
+// between, so no request is lost however fast they arrive. Requests are
+// spread over shards to keep the workers from waiting on one lock, the
+// shards are merged when the test ends.
+type reportAggregator struct {
+	shards []*reportShard
+	next   atomic.Uint64
+}
 
-			return result
-		}
+type reportShard struct {
+	mu      sync.Mutex
+	reports map[any]*shardReport
+	series  *timeSeries
+}
 
-		if _, exists := reqMap[req.Request]; !exists {
-			repCh := make(chan *RequestInfo, REP_CHAN_BUF_SIZE)
-			report := &RequestReport{
-				ReqCods: make(map[int]int),
-				Errors:  make(map[string]int),
-			}
+type shardReport struct {
+	report *RequestReport
+	sums   reportSums
+	// first is when the report got its first request, it keeps the order of
+	// the merged reports.
+	first time.Time
+}
 
-			reqMap[req.Request] = struct {
-				ch  chan *RequestInfo
-				rep *RequestReport
-			}{
-				ch:  repCh,
-				rep: report,
-			}
+func newReportAggregator(start time.Time) *reportAggregator {
+	a := &reportAggregator{shards: make([]*reportShard, runtime.GOMAXPROCS(0))}
+	for i := range a.shards {
+		a.shards[i] = &reportShard{
+			reports: make(map[any]*shardReport),
+			series:  newTimeSeries(start),
+		}
+	}
+	return a
+}
+
+func newRequestReport() *RequestReport {
+	return &RequestReport{
+		ReqCods:      make(map[int]int),
+		Errors:       make(map[string]*ErrorSummary),
+		ProxyErrors:  make(map[string]int),
+		Latency:      NewHistogram(),
+		ResponseTime: NewHistogram(),
+		BodySizes:    NewHistogram(),
+	}
+}
 
-			result = append(result, report)
+func (a *reportAggregator) add(req *RequestInfo) {
+	shard := a.shards[a.next.Add(1)%uint64(len(a.shards))]
 
-			calcRepWg.Add(1)
-			go func() {
-				calcReportLoop(repCh, report)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
 
-				defer func(req Request) {
-					calcRepWg.Done()
-					delete(reqMap, req)
-				}(req.Request)
-			}()
+	shard.series.add(req)
 
-			repCh <- req
-		} else {
-			reqMap[req.Request].ch <- req
-		}
+	key := reportKey(req.Request)
+	rep, ok := shard.reports[key]
+	if !ok {
+		rep = &shardReport{report: newRequestReport(), first: time.Now()}
+		shard.reports[key] = rep
 	}
+	calcReport(&rep.sums, req, rep.report)
 }
 
-func calcReportLoop(in <-chan *RequestInfo, report *RequestReport) {
-	var sum time.Duration
-	for {
-		req, ok := <-in
-		if !ok {
-			return
+// result merges the shards, it must only be called once nothing is added.
+func (a *reportAggregator) result() ([]*RequestReport, []TimeSeriesPoint) {
+	merged := make(map[any]*shardReport)
+	series := a.shards[0].series
+	for i, shard := range a.shards {
+		if i > 0 {
+			series.merge(shard.series)
 		}
+		for key, rep := range shard.reports {
+			total, ok := merged[key]
+			if !ok {
+				total = &shardReport{report: newRequestReport(), first: rep.first}
+				total.report.Url = rep.report.Url
+				total.report.Name = rep.report.Name
+				total.report.Group = rep.report.Group
+				total.report.Tags = rep.report.Tags
+				merged[key] = total
+			}
+			if rep.first.Before(total.first) {
+				total.first = rep.first
+			}
+			total.report.merge(rep.report)
+		}
+	}
+
+	reports := make([]*shardReport, 0, len(merged))
+	for _, rep := range merged {
+		reports = append(reports, rep)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].first.Before(reports[j].first)
+	})
+
+	result := make([]*RequestReport, len(reports))
+	for i, rep := range reports {
+		result[i] = rep.report
+	}
+	return result, series.result()
+}
 
-		calcReport(&sum, req, report)
+// reportKey puts named requests with the same name and group into one report,
+// unnamed requests get a report each.
+func reportKey(req Request) any {
+	name := req.GetName()
+	if name == "" {
+		return req
 	}
+	group := ""
+	if httpReq, ok := req.(*HTTPRequest); ok {
+		group = httpReq.Group
+	}
+	return [2]string{group, name}
 }
 
-func calcReport(sum *time.Duration, req *RequestInfo, report *RequestReport) {
+func calcReport(sums *reportSums, req *RequestInfo, report *RequestReport) {
 	if report.Url == "" {
 		report.Url = req.Request.GetURI()
+		report.Name = req.Request.GetName()
+		report.Tags = req.Request.GetTags()
+		if httpReq, ok := req.Request.(*HTTPRequest); ok {
+			report.Group = httpReq.Group
+		}
 	}
 
 	report.Count++
-	*sum += req.Time
+	sums.time += req.Time
 
 	if report.MinTime == 0 {
 		report.MinTime = req.Time
@@ -107,8 +228,275 @@ func calcReport(sum *time.Duration, req *RequestInfo, report *RequestReport) {
 	}
 
 	if req.Err != nil {
-		report.Errors[req.Err.Error()]++
+		class := ClassifyError(req.Err)
+		summary, ok := report.Errors[class.String()]
+		if !ok {
+			summary = &ErrorSummary{
+				Category: class.Category,
+				Code:     class.Code,
+				Sample:   TruncateString(req.Err.Error(), MAX_ERROR_SAMPLE_LEN),
+			}
+			report.Errors[class.String()] = summary
+		}
+		summary.Count++
+
+		var proxyErr *ProxyError
+		if errors.As(req.Err, &proxyErr) {
+			report.ProxyErrors[proxyErr.Proxy]++
+		}
+	}
+
+	report.AvgTime = time.Duration(float64(sums.time) / float64(report.Count))
+
+	if req.Response != nil || req.Time > 0 {
+		responseTime := req.Time + req.Lag
+		sums.responseTime += responseTime
+
+		report.Latency.Record(req.Time.Microseconds())
+		report.ResponseTime.Record(responseTime.Microseconds())
+		report.AvgResponseTime = time.Duration(float64(sums.responseTime) / float64(report.ResponseTime.Total))
+		report.MaxResponseTime = max(report.MaxResponseTime, responseTime)
+	}
+
+	if req.Late {
+		report.LateRequests++
+	}
+
+	if !req.Scheduled.IsZero() {
+		sent := req.Scheduled.Add(req.Lag)
+		if report.Started.IsZero() || sent.Before(report.Started) {
+			report.Started = sent
+		}
+		if finished := sent.Add(req.Time); finished.After(report.Finished) {
+			report.Finished = finished
+		}
+	}
+
+	if req.Response != nil {
+		report.BytesSent += req.BytesSent
+		report.BytesReceived += req.BytesReceived
+		report.BodySizes.Record(req.BodySize)
+	}
+	report.MaxLag = max(report.MaxLag, req.Lag)
+
+	if req.Phases != nil {
+		calcPhases(sums, req.Phases, &report.Phases)
+	}
+}
+
+func calcPhases(sums *reportSums, phases *ConnPhases, report *PhaseReport) {
+	if phases.Reused {
+		report.ReusedConns++
+	} else {
+		report.NewConns++
+		sums.dns += phases.DNS
+		sums.connect += phases.Connect
+		sums.tls += phases.TLS
+
+		report.AvgDNS = sums.dns / time.Duration(report.NewConns)
+		report.AvgConnect = sums.connect / time.Duration(report.NewConns)
+		report.AvgTLS = sums.tls / time.Duration(report.NewConns)
+	}
+
+	sums.ttfb += phases.TTFB
+	sums.transfer += phases.Transfer
+
+	traced := time.Duration(report.NewConns + report.ReusedConns)
+	report.AvgTTFB = sums.ttfb / traced
+	report.AvgTransfer = sums.transfer / traced
+}
+
+func (r *RequestReport) LatencyPercentile(p float64) time.Duration {
+	return time.Duration(r.Latency.Percentile(p)) * time.Microsecond
+}
+
+func (r *RequestReport) ResponseTimePercentile(p float64) time.Duration {
+	return time.Duration(r.ResponseTime.Percentile(p)) * time.Microsecond
+}
+
+func (r *RequestReport) SentPerSecond() float64 {
+	elapsed := r.Finished.Sub(r.Started).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(r.BytesSent) / elapsed
+}
+
+func (r *RequestReport) ReceivedPerSecond() float64 {
+	elapsed := r.Finished.Sub(r.Started).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(r.BytesReceived) / elapsed
+}
+
+func (r *RequestReport) RequestsPerSecond() float64 {
+	elapsed := r.Finished.Sub(r.Started).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Count) / elapsed
+}
+
+func (r *RequestReport) ErrorCount() int {
+	count := 0
+	for _, summary := range r.Errors {
+		count += summary.Count
+	}
+	return count
+}
+
+// ErrorCategories returns the error classes, most frequent first.
+func (r *RequestReport) ErrorCategories() []*ErrorSummary {
+	return sortErrorSummaries(r.Errors)
+}
+
+// ErrorTotals sums the error classes of all requests, most frequent first.
+func (r *TestReport) ErrorTotals() []*ErrorSummary {
+	totals := make(map[string]*ErrorSummary)
+	for _, rep := range r.Requests {
+		for key, summary := range rep.Errors {
+			total, ok := totals[key]
+			if !ok {
+				total = &ErrorSummary{Category: summary.Category, Code: summary.Code, Sample: summary.Sample}
+				totals[key] = total
+			}
+			total.Count += summary.Count
+		}
+	}
+	return sortErrorSummaries(totals)
+}
+
+// MetricNames returns the names of the script metrics in order.
+func (r *TestReport) MetricNames() []string {
+	names := make([]string, 0, len(r.Metrics))
+	for name := range r.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortErrorSummaries(summaries map[string]*ErrorSummary) []*ErrorSummary {
+	result := make([]*ErrorSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		result = append(result, summary)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Class().String() < result[j].Class().String()
+	})
+	return result
+}
+
+// TagReports merges the requests of every tag into one report named after
+// the tag, sorted by tag.
+func (r *TestReport) TagReports() []*RequestReport {
+	byTag := make(map[string]*RequestReport)
+	for _, rep := range r.Requests {
+		for _, tag := range rep.Tags {
+			tagReport, ok := byTag[tag]
+			if !ok {
+				tagReport = newRequestReport()
+				tagReport.Name = tag
+				byTag[tag] = tagReport
+			}
+			tagReport.merge(rep)
+		}
+	}
+
+	result := make([]*RequestReport, 0, len(byTag))
+	for _, tagReport := range byTag {
+		result = append(result, tagReport)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func (r *RequestReport) merge(other *RequestReport) {
+	if other.Count == 0 {
+		return
+	}
+
+	r.AvgTime = weightedAvg(r.AvgTime, r.Count, other.AvgTime, other.Count)
+	if r.Count == 0 || other.MinTime < r.MinTime {
+		r.MinTime = other.MinTime
+	}
+	r.MaxTime = max(r.MaxTime, other.MaxTime)
+	r.Count += other.Count
+
+	for code, count := range other.ReqCods {
+		r.ReqCods[code] += count
+	}
+	for key, summary := range other.Errors {
+		total, ok := r.Errors[key]
+		if !ok {
+			total = &ErrorSummary{Category: summary.Category, Code: summary.Code, Sample: summary.Sample}
+			r.Errors[key] = total
+		}
+		total.Count += summary.Count
 	}
+	for proxy, count := range other.ProxyErrors {
+		r.ProxyErrors[proxy] += count
+	}
+
+	traced, otherTraced := r.Phases.NewConns+r.Phases.ReusedConns, other.Phases.NewConns+other.Phases.ReusedConns
+	r.Phases.AvgDNS = weightedAvg(r.Phases.AvgDNS, r.Phases.NewConns, other.Phases.AvgDNS, other.Phases.NewConns)
+	r.Phases.AvgConnect = weightedAvg(r.Phases.AvgConnect, r.Phases.NewConns, other.Phases.AvgConnect, other.Phases.NewConns)
+	r.Phases.AvgTLS = weightedAvg(r.Phases.AvgTLS, r.Phases.NewConns, other.Phases.AvgTLS, other.Phases.NewConns)
+	r.Phases.AvgTTFB = weightedAvg(r.Phases.AvgTTFB, traced, other.Phases.AvgTTFB, otherTraced)
+	r.Phases.AvgTransfer = weightedAvg(r.Phases.AvgTransfer, traced, other.Phases.AvgTransfer, otherTraced)
+	r.Phases.NewConns += other.Phases.NewConns
+	r.Phases.ReusedConns += other.Phases.ReusedConns
+
+	r.AvgResponseTime = weightedAvg(r.AvgResponseTime, int(r.ResponseTime.Total), other.AvgResponseTime, int(other.ResponseTime.Total))
+	r.MaxResponseTime = max(r.MaxResponseTime, other.MaxResponseTime)
+	r.Latency.Merge(other.Latency)
+	r.ResponseTime.Merge(other.ResponseTime)
+	r.LateRequests += other.LateRequests
+	r.MaxLag = max(r.MaxLag, other.MaxLag)
+
+	r.BytesSent += other.BytesSent
+	r.BytesReceived += other.BytesReceived
+	r.BodySizes.Merge(other.BodySizes)
+	if !other.Started.IsZero() && (r.Started.IsZero() || other.Started.Before(r.Started)) {
+		r.Started = other.Started
+	}
+	if other.Finished.After(r.Finished) {
+		r.Finished = other.Finished
+	}
+}
+
+func weightedAvg(a time.Duration, aCount int, b time.Duration, bCount int) time.Duration {
+	if aCount+bCount == 0 {
+		return 0
+	}
+	return time.Duration((float64(a)*float64(aCount) + float64(b)*float64(bCount)) / float64(aCount+bCount))
+}
+
+func (r *RequestReport) ErrorRate() float64 {
+	if r.Count == 0 {
+		return 0
+	}
+	return float64(r.ErrorCount()) / float64(r.Count)
+}
 
-	report.AvgTime = time.Duration(float64(*sum) / float64(report.Count))
+func newRunConfig(reqsConfig *RequestsConfig) RunConfig {
+	runConfig := RunConfig{
+		Protocol:      reqsConfig.Protocol,
+		Count_Workers: reqsConfig.Count_Workers,
+		Delay:         reqsConfig.Delay,
+		Duration:      reqsConfig.Duration,
+	}
+	for _, req := range reqsConfig.Requests {
+		runConfig.Requests = append(runConfig.Requests, req.GetMethod()+" "+req.GetURI())
+	}
+	if reqsConfig.Replay != nil {
+		runConfig.Requests = append(runConfig.Requests, "REPLAY "+reqsConfig.Replay.Path)
+	}
+	return runConfig
 }
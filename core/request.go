@@ -21,6 +21,24 @@ type RequestInfo struct {
 	Response *Response
 	Request  Request
 	Err      error
+	Cookies  int
+	Phases   *ConnPhases
+
+	// Scheduled is when the request should have been sent, Lag is how late
+	// it actually was. Late is set when the worker missed a whole delay period.
+	Scheduled time.Time
+	Lag       time.Duration
+	Late      bool
+
+	// Bytes on the wire including headers, BodySize is the decoded body.
+	BytesSent     int64
+	BytesReceived int64
+	BodySize      int64
+
+	// Worker is the index of the worker that sent the request.
+	Worker int
+	// Finished is when the engine got the result, before any sink.
+	Finished time.Time
 }
 
 type RequestsConfig struct {
@@ -32,6 +50,26 @@ type RequestsConfig struct {
 	ResponseChanBufSize int
 	Secure              bool
 	Protocol            Protocol
+	Proxy               *ProxyConfig
+	Auth                *AuthConfig
+	Cookies             *CookieConfig
+	TLS                 *TLSConfig
+	DiscardBody         bool
+	// Scenario replaces the random choice of Requests with these steps sent
+	// in order, HTTP only.
+	Scenario []ScenarioStep
+	// Control pauses and resumes the test while it runs, optional.
+	Control *TestControl
+	// Script hooks into the requests or sends them itself, optional.
+	Script *Script
+	// Sinks get every result of the test, each with its own buffer.
+	Sinks []SinkConfig
+	// ResultLog is the path of a file every result is written to while the
+	// test runs, optional. See CreateResultLog for the formats.
+	ResultLog string
+	// Replay sends the requests of an access log instead of Requests,
+	// optional.
+	Replay *ReplayConfig
 }
 
 type Request interface {
@@ -39,11 +77,19 @@ type Request interface {
 	GetMethod() string
 	GetHeaders() http.Header
 	GetBody() []byte
+	GetName() string
+	GetTags() []string
 }
 
 type HTTPRequest struct {
 	*http.Request
 	CachedBody []byte
+	// Name labels the request in reports, like an OpenAPI operationId.
+	// Requests with the same name share one report. Group collects related
+	// requests, like a Postman folder, Tags allow aggregated views.
+	Name  string
+	Group string
+	Tags  []string
 }
 
 func (r *HTTPRequest) GetURI() string {
@@ -62,10 +108,20 @@ func (r *HTTPRequest) GetBody() []byte {
 	return r.CachedBody
 }
 
+func (r *HTTPRequest) GetName() string {
+	return r.Name
+}
+
+func (r *HTTPRequest) GetTags() []string {
+	return r.Tags
+}
+
 type WSRequest struct {
 	URI     string
 	Headers http.Header
 	Payload []byte
+	Name    string
+	Tags    []string
 }
 
 func (r *WSRequest) GetURI() string {
@@ -84,6 +140,14 @@ func (r *WSRequest) GetBody() []byte {
 	return r.Payload
 }
 
+func (r *WSRequest) GetName() string {
+	return r.Name
+}
+
+func (r *WSRequest) GetTags() []string {
+	return r.Tags
+}
+
 type Response struct {
 	Status  int
 	Headers http.Header
@@ -0,0 +1,587 @@
+package core
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RESULT_LOG_DIR_NAME     = "results"
+	RESULT_LOG_BUF_SIZE     = 64 << 10
+	RESULT_LOG_TAG_SEP      = "|"
+	RESULT_LOG_SCRIPT_PROTO = "script"
+)
+
+type ResultLogFormat int
+
+const (
+	RESULT_LOG_JSONL ResultLogFormat = iota
+	RESULT_LOG_CSV
+)
+
+func (f ResultLogFormat) String() string {
+	return [...]string{"JSON Lines", "CSV"}[f]
+}
+
+// RESULT_LOG_COLUMNS is the CSV header, the JSON keys are the same.
+var RESULT_LOG_COLUMNS = []string{
+	"time", "scheduled", "latency_us", "lag_us", "late", "worker", "protocol", "method", "url", "name", "group", "tags",
+	"status", "bytes_sent", "bytes_received", "body_size", "error_category", "error_code", "error", "proxy", "request_index",
+}
+
+// ResultRecord is one request in a result log. Time is when the request was
+// sent, durations are in microseconds, Status is 0 without a response.
+type ResultRecord struct {
+	Time          time.Time  `json:"time"`
+	Scheduled     *time.Time `json:"scheduled,omitempty"`
+	LatencyUs     int64      `json:"latency_us"`
+	LagUs         int64      `json:"lag_us"`
+	Late          bool       `json:"late,omitempty"`
+	Worker        int        `json:"worker"`
+	Protocol      string     `json:"protocol"`
+	Method        string     `json:"method"`
+	URL           string     `json:"url"`
+	Name          string     `json:"name,omitempty"`
+	Group         string     `json:"group,omitempty"`
+	Tags          []string   `json:"tags,omitempty"`
+	Status        int        `json:"status,omitempty"`
+	BytesSent     int64      `json:"bytes_sent"`
+	BytesReceived int64      `json:"bytes_received"`
+	BodySize      int64      `json:"body_size"`
+	ErrorCategory string     `json:"error_category,omitempty"`
+	ErrorCode     int        `json:"error_code,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	Proxy         string     `json:"proxy,omitempty"`
+	// RequestIndex numbers the unnamed requests of the run from 1, their
+	// results share a report like during the run. Named ones have 0.
+	RequestIndex int `json:"request_index,omitempty"`
+}
+
+func DefaultResultLogDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, HISTORY_DIR_NAME, RESULT_LOG_DIR_NAME), nil
+}
+
+// ResultLogFormatOf picks the format from the file name, .jsonl or .csv with
+// an optional .gz for gzip.
+func ResultLogFormatOf(path string) (format ResultLogFormat, compressed bool, err error) {
+	name := strings.ToLower(filepath.Base(path))
+	compressed = strings.HasSuffix(name, ".gz")
+	name = strings.TrimSuffix(name, ".gz")
+
+	switch filepath.Ext(name) {
+	case ".jsonl", ".ndjson":
+		return RESULT_LOG_JSONL, compressed, nil
+	case ".csv":
+		return RESULT_LOG_CSV, compressed, nil
+	}
+	return 0, false, fmt.Errorf("unknown result log format of %q, use .jsonl, .csv, .jsonl.gz or .csv.gz", path)
+}
+
+func newResultRecord(reqInf *RequestInfo) *ResultRecord {
+	record := &ResultRecord{
+		LatencyUs:     reqInf.Time.Microseconds(),
+		LagUs:         reqInf.Lag.Microseconds(),
+		Late:          reqInf.Late,
+		Worker:        reqInf.Worker,
+		BytesSent:     reqInf.BytesSent,
+		BytesReceived: reqInf.BytesReceived,
+		BodySize:      reqInf.BodySize,
+	}
+
+	if reqInf.Scheduled.IsZero() {
+		record.Time = reqInf.Finished.Add(-reqInf.Time)
+	} else {
+		scheduled := reqInf.Scheduled
+		record.Scheduled = &scheduled
+		record.Time = scheduled.Add(reqInf.Lag)
+	}
+
+	if req := reqInf.Request; req != nil {
+		record.Method = req.GetMethod()
+		record.URL = req.GetURI()
+		record.Name = req.GetName()
+		record.Tags = req.GetTags()
+		switch req := req.(type) {
+		case *HTTPRequest:
+			record.Protocol = HTTP.String()
+			record.Group = req.Group
+		case *WSRequest:
+			record.Protocol = WS.String()
+		default:
+			record.Protocol = RESULT_LOG_SCRIPT_PROTO
+		}
+	}
+
+	if reqInf.Response != nil {
+		record.Status = reqInf.Response.Status
+	}
+
+	if reqInf.Err != nil {
+		class := ClassifyError(reqInf.Err)
+		record.ErrorCategory = class.Category.String()
+		record.ErrorCode = class.Code
+		record.Error = TruncateString(reqInf.Err.Error(), MAX_ERROR_SAMPLE_LEN)
+
+		var proxyErr *ProxyError
+		if errors.As(reqInf.Err, &proxyErr) {
+			record.Proxy = proxyErr.Proxy
+		}
+	}
+
+	return record
+}
+
+// ResultLog is a Sink that streams every request to a file while the test
+// runs. Register it with BLOCK_WHEN_FULL to log every request, memory stays
+// bounded by the sink buffer.
+type ResultLog struct {
+	path   string
+	format ResultLogFormat
+	file   *os.File
+	gz     *gzip.Writer
+	buf    *bufio.Writer
+	json   *json.Encoder
+	csv    *csv.Writer
+	err    error
+	// indexes are the RequestIndex of the unnamed requests so far.
+	indexes map[Request]int
+}
+
+// CreateResultLog creates the file and its directory, the format follows
+// the extension, see ResultLogFormatOf.
+func CreateResultLog(path string) (*ResultLog, error) {
+	format, compressed, err := ResultLogFormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create result log directory: %w", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &ResultLog{path: path, format: format, file: file, indexes: make(map[Request]int)}
+	var w io.Writer = file
+	if compressed {
+		l.gz = gzip.NewWriter(file)
+		w = l.gz
+	}
+	l.buf = bufio.NewWriterSize(w, RESULT_LOG_BUF_SIZE)
+
+	switch format {
+	case RESULT_LOG_JSONL:
+		l.json = json.NewEncoder(l.buf)
+	case RESULT_LOG_CSV:
+		l.csv = csv.NewWriter(l.buf)
+		l.err = l.csv.Write(RESULT_LOG_COLUMNS)
+	}
+	return l, nil
+}
+
+func (l *ResultLog) Path() string {
+	return l.path
+}
+
+// Err is the first write error, the log stops writing after it.
+func (l *ResultLog) Err() error {
+	return l.err
+}
+
+func (l *ResultLog) OnRequest(reqInf *RequestInfo) {
+	if l.err != nil {
+		return
+	}
+
+	record := newResultRecord(reqInf)
+	if req := reqInf.Request; req != nil && req.GetName() == "" {
+		index, ok := l.indexes[req]
+		if !ok {
+			index = len(l.indexes) + 1
+			l.indexes[req] = index
+		}
+		record.RequestIndex = index
+	}
+	switch l.format {
+	case RESULT_LOG_JSONL:
+		l.err = l.json.Encode(record)
+	case RESULT_LOG_CSV:
+		l.err = l.csv.Write(record.csvRow())
+	}
+}
+
+func (l *ResultLog) OnIntervalSnapshot(TimeSeriesPoint) {}
+
+// OnFinish closes the log, errors are kept for Err.
+func (l *ResultLog) OnFinish(*TestReport) {
+	l.Close()
+}
+
+// Close flushes and closes the file, OnFinish calls it.
+func (l *ResultLog) Close() error {
+	if l.file == nil {
+		return l.err
+	}
+
+	if l.csv != nil {
+		l.csv.Flush()
+		l.err = errors.Join(l.err, l.csv.Error())
+	}
+	l.err = errors.Join(l.err, l.buf.Flush())
+	if l.gz != nil {
+		l.err = errors.Join(l.err, l.gz.Close())
+	}
+	l.err = errors.Join(l.err, l.file.Close())
+	l.file = nil
+	return l.err
+}
+
+func (r *ResultRecord) csvRow() []string {
+	scheduled := ""
+	if r.Scheduled != nil {
+		scheduled = r.Scheduled.Format(time.RFC3339Nano)
+	}
+	return []string{
+		r.Time.Format(time.RFC3339Nano),
+		scheduled,
+		strconv.FormatInt(r.LatencyUs, 10),
+		strconv.FormatInt(r.LagUs, 10),
+		strconv.FormatBool(r.Late),
+		strconv.Itoa(r.Worker),
+		r.Protocol,
+		r.Method,
+		r.URL,
+		r.Name,
+		r.Group,
+		strings.Join(r.Tags, RESULT_LOG_TAG_SEP),
+		strconv.Itoa(r.Status),
+		strconv.FormatInt(r.BytesSent, 10),
+		strconv.FormatInt(r.BytesReceived, 10),
+		strconv.FormatInt(r.BodySize, 10),
+		r.ErrorCategory,
+		strconv.Itoa(r.ErrorCode),
+		r.Error,
+		r.Proxy,
+		strconv.Itoa(r.RequestIndex),
+	}
+}
+
+func parseCSVRecord(row []string) (*ResultRecord, error) {
+	if len(row) != len(RESULT_LOG_COLUMNS) {
+		return nil, fmt.Errorf("expected %d columns, got %d", len(RESULT_LOG_COLUMNS), len(row))
+	}
+
+	var err error
+	parseInt := func(value string) int64 {
+		n, parseErr := strconv.ParseInt(value, 10, 64)
+		if parseErr != nil && err == nil {
+			err = parseErr
+		}
+		return n
+	}
+
+	record := &ResultRecord{
+		LatencyUs:     parseInt(row[2]),
+		LagUs:         parseInt(row[3]),
+		Late:          row[4] == "true",
+		Worker:        int(parseInt(row[5])),
+		Protocol:      row[6],
+		Method:        row[7],
+		URL:           row[8],
+		Name:          row[9],
+		Group:         row[10],
+		Status:        int(parseInt(row[12])),
+		BytesSent:     parseInt(row[13]),
+		BytesReceived: parseInt(row[14]),
+		BodySize:      parseInt(row[15]),
+		ErrorCategory: row[16],
+		ErrorCode:     int(parseInt(row[17])),
+		Error:         row[18],
+		Proxy:         row[19],
+		RequestIndex:  int(parseInt(row[20])),
+	}
+	if err != nil {
+		return nil, err
+	}
+	if row[11] != "" {
+		record.Tags = strings.Split(row[11], RESULT_LOG_TAG_SEP)
+	}
+	if record.Time, err = time.Parse(time.RFC3339Nano, row[0]); err != nil {
+		return nil, err
+	}
+	if row[1] != "" {
+		scheduled, parseErr := time.Parse(time.RFC3339Nano, row[1])
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		record.Scheduled = &scheduled
+	}
+	return record, nil
+}
+
+// ResultLogReader reads a result log one record at a time.
+type ResultLogReader struct {
+	file   *os.File
+	gz     *gzip.Reader
+	format ResultLogFormat
+	json   *json.Decoder
+	csv    *csv.Reader
+	line   int
+}
+
+func OpenResultLog(path string) (*ResultLogReader, error) {
+	format, compressed, err := ResultLogFormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ResultLogReader{file: file, format: format}
+	var in io.Reader = bufio.NewReaderSize(file, RESULT_LOG_BUF_SIZE)
+	if compressed {
+		if r.gz, err = gzip.NewReader(in); err != nil {
+			file.Close()
+			return nil, err
+		}
+		in = r.gz
+	}
+
+	switch format {
+	case RESULT_LOG_JSONL:
+		r.json = json.NewDecoder(in)
+	case RESULT_LOG_CSV:
+		r.csv = csv.NewReader(in)
+		r.csv.ReuseRecord = true
+		header, err := r.csv.Read()
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to read the CSV header: %w", err)
+		}
+		if strings.Join(header, ",") != strings.Join(RESULT_LOG_COLUMNS, ",") {
+			file.Close()
+			return nil, errors.New("the CSV header doesn't match a result log")
+		}
+		r.line = 1
+	}
+	return r, nil
+}
+
+// Next returns the next record, io.EOF after the last one.
+func (r *ResultLogReader) Next() (*ResultRecord, error) {
+	r.line++
+
+	switch r.format {
+	case RESULT_LOG_CSV:
+		row, err := r.csv.Read()
+		if err != nil {
+			return nil, err
+		}
+		record, err := parseCSVRecord(row)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		return record, nil
+	default:
+		record := &ResultRecord{}
+		if err := r.json.Decode(record); err != nil {
+			if err == io.EOF {
+				return nil, err
+			}
+			return nil, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		return record, nil
+	}
+}
+
+func (r *ResultLogReader) Close() error {
+	if r.gz != nil {
+		r.gz.Close()
+	}
+	return r.file.Close()
+}
+
+// ReportFromResultLog recomputes the report of a test from its result log.
+// The log has no connection phases, cookies or script metrics, the rest
+// matches the report of the run.
+func ReportFromResultLog(path string) (*TestReport, error) {
+	// Records are written as they finish, the earliest isn't always first.
+	started, err := resultLogStart(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := OpenResultLog(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	requests := make(map[string]Request)
+	reports := newReportAggregator(started)
+	report := &TestReport{Started: started}
+
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		reqInf := record.requestInfo(requests)
+		reports.add(reqInf)
+
+		if finished := record.Time.Add(reqInf.Time); finished.After(report.Finished) {
+			report.Finished = finished
+		}
+	}
+
+	report.ID = NewRunID(report.Started)
+	report.Requests, report.TimeSeries = reports.result()
+	return report, nil
+}
+
+// resultLogStart is the time of the earliest record.
+func resultLogStart(path string) (time.Time, error) {
+	r, err := OpenResultLog(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer r.Close()
+
+	var started time.Time
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		if started.IsZero() || record.Time.Before(started) {
+			started = record.Time
+		}
+	}
+	if started.IsZero() {
+		return time.Time{}, errors.New("the result log is empty")
+	}
+	return started, nil
+}
+
+// requestInfo rebuilds the result, requests with the same identity share one
+// Request so they end up in one report like during the run.
+func (rec *ResultRecord) requestInfo(requests map[string]Request) *RequestInfo {
+	reqInf := &RequestInfo{
+		Time:          time.Duration(rec.LatencyUs) * time.Microsecond,
+		Lag:           time.Duration(rec.LagUs) * time.Microsecond,
+		Late:          rec.Late,
+		Worker:        rec.Worker,
+		BytesSent:     rec.BytesSent,
+		BytesReceived: rec.BytesReceived,
+		BodySize:      rec.BodySize,
+	}
+	// Results without a schedule would land in the time series at the time
+	// the log is read.
+	reqInf.Scheduled = rec.Time
+	if rec.Scheduled != nil {
+		reqInf.Scheduled = *rec.Scheduled
+	}
+	if rec.Status != 0 {
+		reqInf.Response = &Response{Status: rec.Status}
+	}
+
+	// Unnamed requests are told apart by their index, like reportKey tells
+	// them apart by identity.
+	key := strings.Join([]string{rec.Protocol, rec.Method, rec.URL, rec.Name, rec.Group, strings.Join(rec.Tags, RESULT_LOG_TAG_SEP)}, "\x00")
+	if rec.RequestIndex > 0 {
+		key = "#" + strconv.Itoa(rec.RequestIndex)
+	}
+	req, ok := requests[key]
+	if !ok {
+		req = rec.request()
+		requests[key] = req
+	}
+	reqInf.Request = req
+
+	if rec.ErrorCategory != "" || rec.Error != "" {
+		logged := &loggedError{
+			class:   ErrorClass{Category: parseErrorCategory(rec.ErrorCategory), Code: rec.ErrorCode},
+			message: rec.Error,
+		}
+		reqInf.Err = logged
+		if rec.Proxy != "" {
+			// The logged message already starts with the proxy.
+			logged.message = strings.TrimPrefix(rec.Error, "proxy "+rec.Proxy+": ")
+			reqInf.Err = &ProxyError{Proxy: rec.Proxy, Err: logged}
+		}
+	}
+	return reqInf
+}
+
+func (rec *ResultRecord) request() Request {
+	switch rec.Protocol {
+	case WS.String():
+		return &WSRequest{URI: rec.URL, Name: rec.Name, Tags: rec.Tags}
+	case HTTP.String():
+		if httpReq, err := http.NewRequest(rec.Method, rec.URL, nil); err == nil {
+			return &HTTPRequest{Request: httpReq, Name: rec.Name, Group: rec.Group, Tags: rec.Tags}
+		}
+	case RESULT_LOG_SCRIPT_PROTO:
+		if function, ok := strings.CutPrefix(rec.URL, "script:"); ok {
+			return &scriptRequest{function: function}
+		}
+	}
+	return &loggedRequest{method: rec.Method, uri: rec.URL, name: rec.Name, tags: rec.Tags}
+}
+
+// loggedRequest stands for a logged request that can't be rebuilt.
+type loggedRequest struct {
+	method string
+	uri    string
+	name   string
+	tags   []string
+}
+
+func (r *loggedRequest) GetURI() string {
+	return r.uri
+}
+
+func (r *loggedRequest) GetMethod() string {
+	return r.method
+}
+
+func (r *loggedRequest) GetHeaders() http.Header {
+	return nil
+}
+
+func (r *loggedRequest) GetBody() []byte {
+	return nil
+}
+
+func (r *loggedRequest) GetName() string {
+	return r.name
+}
+
+func (r *loggedRequest) GetTags() []string {
+	return r.tags
+}
@@ -0,0 +1,398 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRunnerStarted    = errors.New("the runner was already started")
+	ErrRunnerNotStarted = errors.New("the runner wasn't started")
+)
+
+// Runner runs one load test from Go code, e.g. inside an integration test:
+//
+//	req, _ := http.NewRequest(http.MethodGet, target, nil)
+//	runner := core.NewRunner(
+//		core.WithRequests(&core.HTTPRequest{Request: req}),
+//		core.WithWorkers(20),
+//		core.WithRate(200),
+//		core.WithDuration(30*time.Second),
+//	)
+//	if err := runner.Start(ctx); err != nil {
+//		return err
+//	}
+//	if err := runner.Wait(); err != nil {
+//		return err
+//	}
+//	report := runner.Result()
+//
+// A Runner can't be started twice, create a new one for every test.
+type Runner struct {
+	config    RequestsConfig
+	rate      float64
+	onRequest func(*RequestInfo)
+	control   *TestControl
+
+	mu      sync.Mutex
+	started bool
+	cancel  context.CancelFunc
+	done    chan struct{}
+	result  *TestReport
+	err     error
+	stats   runnerStats
+}
+
+// Option configures a Runner, options are checked by Start.
+type Option func(*Runner)
+
+// Snapshot are the live metrics of a running test.
+type Snapshot struct {
+	Running bool
+	Paused  bool
+	// Elapsed doesn't count pauses.
+	Elapsed       time.Duration
+	Workers       int
+	Delay         time.Duration
+	Requests      int
+	Errors        int
+	ErrorsByClass map[string]int
+	AvgTime       time.Duration
+	MinTime       time.Duration
+	MaxTime       time.Duration
+	BytesSent     int64
+	BytesReceived int64
+	// Dropped results missed a sink with DROP_WHEN_FULL, Requests counts them.
+	Dropped int64
+}
+
+type runnerStats struct {
+	requests      int
+	errors        int
+	errorsByClass map[string]int
+	sumTime       time.Duration
+	minTime       time.Duration
+	maxTime       time.Duration
+	bytesSent     int64
+	bytesReceived int64
+}
+
+func NewRunner(opts ...Option) *Runner {
+	r := &Runner{
+		config:  RequestsConfig{Protocol: HTTP},
+		control: NewTestControl(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+func WithRequests(reqs ...Request) Option {
+	return func(r *Runner) {
+		r.config.Requests = append(r.config.Requests, reqs...)
+	}
+}
+
+// WithScenario sends the steps in order instead of random requests.
+func WithScenario(steps ...ScenarioStep) Option {
+	return func(r *Runner) {
+		r.config.Scenario = append(r.config.Scenario, steps...)
+	}
+}
+
+func WithProtocol(p Protocol) Option {
+	return func(r *Runner) {
+		r.config.Protocol = p
+	}
+}
+
+func WithWorkers(n int) Option {
+	return func(r *Runner) {
+		r.config.Count_Workers = n
+	}
+}
+
+// WithDelay sets the delay between the requests of each worker.
+func WithDelay(d time.Duration) Option {
+	return func(r *Runner) {
+		r.config.Delay = d
+		r.rate = 0
+	}
+}
+
+// WithRate sets the delay so all workers together send rps requests per
+// second, it replaces WithDelay.
+func WithRate(rps float64) Option {
+	return func(r *Runner) {
+		r.rate = rps
+	}
+}
+
+func WithDuration(d time.Duration) Option {
+	return func(r *Runner) {
+		r.config.Duration = d
+	}
+}
+
+func WithScript(s *Script) Option {
+	return func(r *Runner) {
+		r.config.Script = s
+	}
+}
+
+func WithAuth(auth *AuthConfig) Option {
+	return func(r *Runner) {
+		r.config.Auth = auth
+	}
+}
+
+func WithProxy(proxy *ProxyConfig) Option {
+	return func(r *Runner) {
+		r.config.Proxy = proxy
+	}
+}
+
+func WithCookies(cookies *CookieConfig) Option {
+	return func(r *Runner) {
+		r.config.Cookies = cookies
+	}
+}
+
+func WithTLS(tls *TLSConfig) Option {
+	return func(r *Runner) {
+		r.config.TLS = tls
+	}
+}
+
+// WithInsecureTLS skips the verification of server certificates.
+func WithInsecureTLS() Option {
+	return func(r *Runner) {
+		r.config.Secure = true
+	}
+}
+
+// WithDiscardBody doesn't keep response bodies, only their size.
+func WithDiscardBody() Option {
+	return func(r *Runner) {
+		r.config.DiscardBody = true
+	}
+}
+
+// WithSink registers a sink for the results, see SinkConfig.
+func WithSink(sink Sink, policy SinkPolicy, bufferSize int) Option {
+	return func(r *Runner) {
+		r.config.Sinks = append(r.config.Sinks, SinkConfig{Sink: sink, Policy: policy, BufferSize: bufferSize})
+	}
+}
+
+// WithResultLog writes every result to the file at path, see
+// CreateResultLog.
+func WithResultLog(path string) Option {
+	return func(r *Runner) {
+		r.config.ResultLog = path
+	}
+}
+
+// WithReplay replays an access log instead of sending requests, see
+// ReplayConfig.
+func WithReplay(replay ReplayConfig) Option {
+	return func(r *Runner) {
+		r.config.Replay = &replay
+	}
+}
+
+// WithOnRequest calls fn with every finished request. It's called from a
+// single goroutine and slows the test down if it blocks.
+func WithOnRequest(fn func(*RequestInfo)) Option {
+	return func(r *Runner) {
+		r.onRequest = fn
+	}
+}
+
+// Start checks the options and starts the test in the background. The test
+// ends after its duration, on Stop or when ctx is done.
+func (r *Runner) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.started {
+		return ErrRunnerStarted
+	}
+
+	config := r.config
+	if r.rate != 0 {
+		if r.rate < 0 {
+			return fmt.Errorf("target rate must be positive, got %v", r.rate)
+		}
+		workers := config.Count_Workers
+		if workers == 0 {
+			workers = DEFAULT_COUNT_WORKERS
+		}
+		config.Delay = RateDelay(workers, r.rate)
+		r.control.keepRate(r.rate)
+	}
+	reqsConfig, err := checkRequestsConfig(&config)
+	if err != nil {
+		return err
+	}
+	if err := validateSinks(reqsConfig.Sinks); err != nil {
+		return err
+	}
+	if reqsConfig.ResultLog != "" {
+		if _, _, err := ResultLogFormatOf(reqsConfig.ResultLog); err != nil {
+			return err
+		}
+	}
+	reqsConfig.Control = r.control
+
+	runCtx, cancel := context.WithCancel(ctx)
+	r.started = true
+	r.cancel = cancel
+	r.done = make(chan struct{})
+
+	stats := SinkConfig{Sink: SinkFuncs{Request: r.record}, Policy: BLOCK_WHEN_FULL}
+
+	go func() {
+		report, err := runTest(reqsConfig, runCtx, stats)
+		cancel()
+
+		r.mu.Lock()
+		r.result = report
+		r.err = err
+		r.mu.Unlock()
+		close(r.done)
+	}()
+
+	return nil
+}
+
+func (r *Runner) record(reqInf *RequestInfo) {
+	if r.onRequest != nil {
+		r.onRequest(reqInf)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := &r.stats
+	s.requests++
+	if reqInf.Err != nil {
+		s.errors++
+		if s.errorsByClass == nil {
+			s.errorsByClass = make(map[string]int)
+		}
+		s.errorsByClass[ClassifyError(reqInf.Err).String()]++
+	}
+	s.sumTime += reqInf.Time
+	if s.requests == 1 || reqInf.Time < s.minTime {
+		s.minTime = reqInf.Time
+	}
+	s.maxTime = max(s.maxTime, reqInf.Time)
+	s.bytesSent += reqInf.BytesSent
+	s.bytesReceived += reqInf.BytesReceived
+}
+
+// Wait blocks until the test is over and returns the error that kept it
+// from running, stopped the replay early or left the result log incomplete,
+// Result is set in the latter cases. Failed requests aren't errors of the test.
+func (r *Runner) Wait() error {
+	r.mu.Lock()
+	done := r.done
+	r.mu.Unlock()
+
+	if done == nil {
+		return ErrRunnerNotStarted
+	}
+	<-done
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Stop ends the test early and waits for it like Wait.
+func (r *Runner) Stop() error {
+	r.mu.Lock()
+	cancel := r.cancel
+	r.mu.Unlock()
+
+	if cancel == nil {
+		return ErrRunnerNotStarted
+	}
+	cancel()
+	return r.Wait()
+}
+
+// Result is the report of the finished test, nil while it runs.
+func (r *Runner) Result() *TestReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.result
+}
+
+// Control pauses, resumes and changes the load of the test while it runs.
+func (r *Runner) Control() *TestControl {
+	return r.control
+}
+
+func (r *Runner) Snapshot() Snapshot {
+	r.mu.Lock()
+	s := r.stats
+	snapshot := Snapshot{
+		Running:       r.running(),
+		Requests:      s.requests,
+		Errors:        s.errors,
+		ErrorsByClass: make(map[string]int, len(s.errorsByClass)),
+		MinTime:       s.minTime,
+		MaxTime:       s.maxTime,
+		BytesSent:     s.bytesSent,
+		BytesReceived: s.bytesReceived,
+	}
+	for class, count := range s.errorsByClass {
+		snapshot.ErrorsByClass[class] = count
+	}
+	if s.requests > 0 {
+		snapshot.AvgTime = s.sumTime / time.Duration(s.requests)
+	}
+	r.mu.Unlock()
+
+	snapshot.Paused = r.control.Paused()
+	snapshot.Elapsed = r.control.Elapsed()
+	if result := r.Result(); result != nil {
+		snapshot.Elapsed = result.Finished.Sub(result.Started) - result.Paused
+	}
+	snapshot.Workers = r.control.Workers()
+	snapshot.Delay = r.control.Delay()
+	snapshot.Dropped = r.control.Dropped()
+	return snapshot
+}
+
+func (r *Runner) running() bool {
+	if r.done == nil {
+		return false
+	}
+	select {
+	case <-r.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (s Snapshot) RequestsPerSecond() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Requests) / s.Elapsed.Seconds()
+}
+
+func (s Snapshot) ErrorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Requests)
+}
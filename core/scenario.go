@@ -0,0 +1,39 @@
+package core
+
+import (
+	"context"
+	"time"
+)
+
+// ScenarioStep is one request of an ordered scenario. Delay is the pause
+// between the start of the previous step and this one.
+type ScenarioStep struct {
+	Request *HTTPRequest
+	Delay   time.Duration
+}
+
+func scenarioRequests(steps []ScenarioStep) []Request {
+	requests := make([]Request, 0, len(steps))
+	for _, step := range steps {
+		requests = append(requests, step.Request)
+	}
+	return requests
+}
+
+// sleepUntil waits for t, returns false when ctx is done first.
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"context"
+	"time"
+)
+
+// schedule keeps the intended send times of one worker independent of how
+// long the requests take. When the server stalls the worker sends the missed
+// requests as soon as it can instead of silently skipping them, so the stall
+// shows up in the corrected response time.
+//
+// The delay is read from the control before every request and a change
+// moves the pending send time, closing retire stops the worker.
+type schedule struct {
+	next time.Time
+	// last is the previous intended send time, zero before the first.
+	last    time.Time
+	control *TestControl
+	retire  <-chan struct{}
+}
+
+func newSchedule(start time.Time, control *TestControl, retire <-chan struct{}) *schedule {
+	return &schedule{next: start, control: control, retire: retire}
+}
+
+// wait blocks until the next intended send time and returns it, ok is false
+// when ctx is done or the worker was retired. Sends missed while the test was
+// paused are skipped, the schedule restarts on resume.
+func (s *schedule) wait(ctx context.Context) (time.Time, bool) {
+	for {
+		intended := s.next
+
+		select {
+		case <-s.retire:
+			return intended, false
+		default:
+		}
+
+		if d := time.Until(intended); d > 0 {
+			_, _, changed := s.control.load()
+			timer := time.NewTimer(d)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return intended, false
+			case <-s.retire:
+				timer.Stop()
+				return intended, false
+			case <-changed:
+				// A new delay counts from the previous send.
+				timer.Stop()
+				if !s.last.IsZero() {
+					s.next = s.last.Add(s.control.Delay())
+				}
+				continue
+			case <-timer.C:
+			}
+		}
+
+		waited, ok := s.control.wait(ctx)
+		if !ok {
+			return intended, false
+		}
+		if waited {
+			s.next, s.last = time.Now(), time.Time{}
+			continue
+		}
+
+		s.last = intended
+		s.next = intended.Add(s.control.Delay())
+		return intended, ctx.Err() == nil
+	}
+}
+
+// mark fills the scheduling fields of reqInf for a request sent at start.
+func (s *schedule) mark(reqInf *RequestInfo, intended, start time.Time) {
+	reqInf.Scheduled = intended
+	reqInf.Lag = max(start.Sub(intended), 0)
+	reqInf.Late = reqInf.Lag > s.control.Delay()
+}
+
+// skipTo moves the next send time to t if the worker is already behind it,
+// for workers that pace themselves instead of keeping a fixed rate.
+func (s *schedule) skipTo(t time.Time) {
+	if s.next.Before(t) {
+		s.next = t
+	}
+}
@@ -0,0 +1,534 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+const (
+	SCRIPT_TEARDOWN_TIMEOUT = 10 * time.Second
+)
+
+var errTestOver = errors.New("the test is over")
+
+// Functions a script may define, all of them optional:
+//
+//	setup()                  once per worker before the first request
+//	iteration()              on every scheduled send instead of the configured requests
+//	beforeRequest(req)       before each configured request, may change req or return false to skip it
+//	afterResponse(req, res)  after each configured request
+//	teardown()               once per worker after the test
+var scriptFunctions = []string{"setup", "iteration", "beforeRequest", "afterResponse", "teardown"}
+
+// Script is a compiled JavaScript file. Every worker runs it in a runtime of
+// its own, so plain globals are per worker, vars.get and vars.set share values
+// between workers.
+type Script struct {
+	program   *goja.Program
+	functions map[string]bool
+}
+
+// ScriptError is an exception thrown by a script function.
+type ScriptError struct {
+	Function string
+	Err      error
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("script %s: %v", e.Function, e.Err)
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+// MetricSummary aggregates the values a script recorded with metric().
+type MetricSummary struct {
+	Count int
+	Sum   float64
+	Min   float64
+	Max   float64
+}
+
+func (m *MetricSummary) Mean() float64 {
+	if m.Count == 0 {
+		return 0
+	}
+	return m.Sum / float64(m.Count)
+}
+
+// CompileScript parses source and runs its top level once to find the
+// functions it defines. The top level should only define functions and
+// constants, requests can be sent from the functions only.
+func CompileScript(source string) (*Script, error) {
+	program, err := goja.Compile("script.js", source, true)
+	if err != nil {
+		return nil, err
+	}
+
+	rt := goja.New()
+	installScriptAPI(rt, nil)
+	if _, err := rt.RunProgram(program); err != nil {
+		return nil, err
+	}
+
+	script := &Script{program: program, functions: make(map[string]bool)}
+	for _, name := range scriptFunctions {
+		if _, ok := goja.AssertFunction(rt.Get(name)); ok {
+			script.functions[name] = true
+		}
+	}
+	if len(script.functions) == 0 {
+		return nil, fmt.Errorf("script defines none of the functions %s", strings.Join(scriptFunctions, ", "))
+	}
+
+	return script, nil
+}
+
+// HasIteration reports whether the script sends the requests itself.
+func (s *Script) HasIteration() bool {
+	return s.functions["iteration"]
+}
+
+// scriptShared holds what the runtimes of all workers share.
+type scriptShared struct {
+	mu sync.Mutex
+	// vars are stored as JSON, so every vars.get returns a copy of its own.
+	vars    map[string][]byte
+	metrics map[string]*MetricSummary
+}
+
+func newScriptShared() *scriptShared {
+	return &scriptShared{vars: make(map[string][]byte), metrics: make(map[string]*MetricSummary)}
+}
+
+func (s *scriptShared) record(name string, value float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	metric, ok := s.metrics[name]
+	if !ok {
+		metric = &MetricSummary{Min: math.Inf(1), Max: math.Inf(-1)}
+		s.metrics[name] = metric
+	}
+	metric.Count++
+	metric.Sum += value
+	metric.Min = min(metric.Min, value)
+	metric.Max = max(metric.Max, value)
+}
+
+func (s *scriptShared) result() map[string]*MetricSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.metrics) == 0 {
+		return nil
+	}
+	result := make(map[string]*MetricSummary, len(s.metrics))
+	for name, metric := range s.metrics {
+		copied := *metric
+		result[name] = &copied
+	}
+	return result
+}
+
+// scriptVU is the script runtime of one worker, a virtual user.
+type scriptVU struct {
+	rt        *goja.Runtime
+	script    *Script
+	shared    *scriptShared
+	functions map[string]goja.Callable
+	// ctx is the context of the function running now.
+	ctx context.Context
+
+	// Set by the worker, send one request for the script.
+	sendHTTP func(ctx context.Context, req *HTTPRequest) (*RequestInfo, bool)
+	sendWS   func(ctx context.Context, payload []byte) (*RequestInfo, bool)
+}
+
+func newScriptVU(script *Script, shared *scriptShared) (*scriptVU, error) {
+	vu := &scriptVU{
+		rt:        goja.New(),
+		script:    script,
+		shared:    shared,
+		functions: make(map[string]goja.Callable),
+		ctx:       context.Background(),
+	}
+	installScriptAPI(vu.rt, vu)
+
+	if _, err := vu.rt.RunProgram(script.program); err != nil {
+		return nil, err
+	}
+	for name := range script.functions {
+		vu.functions[name], _ = goja.AssertFunction(vu.rt.Get(name))
+	}
+
+	return vu, nil
+}
+
+func (vu *scriptVU) has(name string) bool {
+	return vu != nil && vu.functions[name] != nil
+}
+
+// call runs a script function, interrupting it when ctx is done. It returns
+// nil when the script doesn't define the function.
+func (vu *scriptVU) call(ctx context.Context, name string, args ...any) (goja.Value, error) {
+	fn := vu.functions[name]
+	if fn == nil {
+		return nil, nil
+	}
+
+	vu.ctx = ctx
+	vu.rt.ClearInterrupt()
+	stop := context.AfterFunc(ctx, func() {
+		vu.rt.Interrupt(ctx.Err())
+	})
+	defer stop()
+
+	values := make([]goja.Value, len(args))
+	for i, arg := range args {
+		values[i] = vu.rt.ToValue(arg)
+	}
+
+	result, err := fn(goja.Undefined(), values...)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &ScriptError{Function: name, Err: err}
+	}
+	return result, nil
+}
+
+// beforeRequest lets the script change a configured request. It returns the
+// request to send, or skip when the script returned false.
+func (vu *scriptVU) beforeRequest(ctx context.Context, req *HTTPRequest) (sent *HTTPRequest, skip bool, err error) {
+	if !vu.has("beforeRequest") {
+		return req, false, nil
+	}
+
+	obj := requestObject(req.GetMethod(), req.GetURI(), req.GetHeaders(), req.GetBody(), req.Name)
+	result, err := vu.call(ctx, "beforeRequest", obj)
+	if err != nil {
+		return nil, false, err
+	}
+	if returnedFalse(result) {
+		return nil, true, nil
+	}
+
+	sent, err = requestFromObject(obj, req)
+	if err != nil {
+		return nil, false, &ScriptError{Function: "beforeRequest", Err: err}
+	}
+	return sent, false, nil
+}
+
+// beforeMessage lets the script change a WebSocket payload, like beforeRequest.
+func (vu *scriptVU) beforeMessage(ctx context.Context, req *WSRequest, payload []byte) ([]byte, bool, error) {
+	if !vu.has("beforeRequest") {
+		return payload, false, nil
+	}
+
+	obj := requestObject("", req.GetURI(), req.GetHeaders(), payload, req.Name)
+	result, err := vu.call(ctx, "beforeRequest", obj)
+	if err != nil {
+		return nil, false, err
+	}
+	if returnedFalse(result) {
+		return nil, true, nil
+	}
+
+	body, err := bodyFromValue(obj["body"])
+	if err != nil {
+		return nil, false, &ScriptError{Function: "beforeRequest", Err: err}
+	}
+	return body, false, nil
+}
+
+// returnedFalse reports whether a hook asked to skip the request.
+func returnedFalse(result goja.Value) bool {
+	if result == nil {
+		return false
+	}
+	value, ok := result.Export().(bool)
+	return ok && !value
+}
+
+func (vu *scriptVU) afterResponse(ctx context.Context, reqInf *RequestInfo) error {
+	if !vu.has("afterResponse") {
+		return nil
+	}
+
+	req := reqInf.Request
+	_, err := vu.call(ctx, "afterResponse",
+		requestObject(req.GetMethod(), req.GetURI(), req.GetHeaders(), req.GetBody(), req.GetName()),
+		responseObject(reqInf))
+	return err
+}
+
+func requestObject(method, url string, header http.Header, body []byte, name string) map[string]any {
+	headers := make(map[string]any, len(header))
+	for key := range header {
+		headers[key] = header.Get(key)
+	}
+	return map[string]any{
+		"method":  method,
+		"url":     url,
+		"headers": headers,
+		"body":    string(body),
+		"name":    name,
+	}
+}
+
+// requestFromObject builds the request the script asked for, headers it
+// removed are removed, multiple values of untouched headers are kept. A Host
+// header sets the host the request is sent with.
+func requestFromObject(obj map[string]any, orig *HTTPRequest) (*HTTPRequest, error) {
+	method, _ := obj["method"].(string)
+	url, _ := obj["url"].(string)
+	body, err := bodyFromValue(obj["body"])
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	// A Host set for the original URL doesn't belong to another one.
+	if req.URL.Host == orig.URL.Host {
+		req.Host = orig.Host
+	}
+	req.Header = orig.Header.Clone()
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+
+	headers, _ := obj["headers"].(map[string]any)
+	for key := range req.Header {
+		if _, ok := headers[key]; !ok {
+			req.Header.Del(key)
+		}
+	}
+	for key, value := range headers {
+		if text := fmt.Sprint(value); http.CanonicalHeaderKey(key) == "Host" {
+			req.Host = text
+		} else if orig.Header.Get(key) != text {
+			req.Header.Set(key, text)
+		}
+	}
+
+	name, _ := obj["name"].(string)
+	return &HTTPRequest{Request: req, CachedBody: body, Name: name, Group: orig.Group, Tags: orig.Tags}, nil
+}
+
+func responseObject(reqInf *RequestInfo) map[string]any {
+	res := map[string]any{
+		"status":  0,
+		"body":    "",
+		"headers": map[string]any{},
+		"time":    float64(reqInf.Time.Microseconds()) / 1000,
+		"error":   nil,
+	}
+	if reqInf.Err != nil {
+		res["error"] = reqInf.Err.Error()
+	}
+	if reqInf.Response != nil {
+		res["status"] = reqInf.Response.Status
+		res["body"] = string(reqInf.Response.Body)
+		headers := make(map[string]any, len(reqInf.Response.Headers))
+		for key := range reqInf.Response.Headers {
+			headers[key] = reqInf.Response.Headers.Get(key)
+		}
+		res["headers"] = headers
+	}
+	return res
+}
+
+// bodyFromValue accepts a string as it is and sends anything else as JSON.
+func bodyFromValue(value any) ([]byte, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []byte(value), nil
+	case goja.Value:
+		return bodyFromValue(value.Export())
+	default:
+		return json.Marshal(value)
+	}
+}
+
+// installScriptAPI defines the globals scripts use. With a nil vu, as when
+// compiling, the functions that need a worker throw.
+func installScriptAPI(rt *goja.Runtime, vu *scriptVU) {
+	throw := func(err error) {
+		panic(rt.NewGoError(err))
+	}
+	needWorker := func(name string) {
+		if vu == nil {
+			throw(fmt.Errorf("%s can only be called from the script functions", name))
+		}
+	}
+
+	request := func(method, url string, options map[string]any) map[string]any {
+		needWorker("http.request")
+		if vu.sendHTTP == nil {
+			throw(errors.New("http.request is only available for the HTTP protocol"))
+		}
+
+		body, err := bodyFromValue(options["body"])
+		if err != nil {
+			throw(err)
+		}
+		req, err := http.NewRequest(strings.ToUpper(method), url, nil)
+		if err != nil {
+			throw(err)
+		}
+		if headers, ok := options["headers"].(map[string]any); ok {
+			for key, value := range headers {
+				req.Header.Set(key, fmt.Sprint(value))
+			}
+		}
+
+		httpReq := &HTTPRequest{Request: req, CachedBody: body}
+		httpReq.Name, _ = options["name"].(string)
+		httpReq.Group, _ = options["group"].(string)
+		if tags, ok := options["tags"].([]any); ok {
+			for _, tag := range tags {
+				httpReq.Tags = append(httpReq.Tags, fmt.Sprint(tag))
+			}
+		}
+		// Requests built by scripts are new every time, the name keeps
+		// them in one report.
+		if httpReq.Name == "" {
+			httpReq.Name = req.Method + " " + url
+		}
+
+		reqInf, ok := vu.sendHTTP(vu.ctx, httpReq)
+		if !ok {
+			throw(errTestOver)
+		}
+		return responseObject(reqInf)
+	}
+
+	httpObj := rt.NewObject()
+	httpObj.Set("request", request)
+	httpObj.Set("get", func(url string, options map[string]any) map[string]any {
+		return request(http.MethodGet, url, options)
+	})
+	httpObj.Set("post", func(url string, body goja.Value, options map[string]any) map[string]any {
+		if options == nil {
+			options = make(map[string]any)
+		}
+		options["body"] = body
+		return request(http.MethodPost, url, options)
+	})
+	rt.Set("http", httpObj)
+
+	wsObj := rt.NewObject()
+	wsObj.Set("send", func(payload goja.Value) map[string]any {
+		needWorker("ws.send")
+		if vu.sendWS == nil {
+			throw(errors.New("ws.send is only available for the WebSocket protocol"))
+		}
+
+		body, err := bodyFromValue(payload)
+		if err != nil {
+			throw(err)
+		}
+		reqInf, ok := vu.sendWS(vu.ctx, body)
+		if !ok {
+			if reqInf != nil {
+				throw(reqInf.Err)
+			}
+			throw(errTestOver)
+		}
+		return responseObject(reqInf)
+	})
+	rt.Set("ws", wsObj)
+
+	varsObj := rt.NewObject()
+	varsObj.Set("get", func(name string) any {
+		needWorker("vars.get")
+		vu.shared.mu.Lock()
+		data, ok := vu.shared.vars[name]
+		vu.shared.mu.Unlock()
+		if !ok {
+			return nil
+		}
+
+		var value any
+		if err := json.Unmarshal(data, &value); err != nil {
+			throw(err)
+		}
+		return value
+	})
+	varsObj.Set("set", func(name string, value goja.Value) {
+		needWorker("vars.set")
+		data, err := json.Marshal(value.Export())
+		if err != nil {
+			throw(fmt.Errorf("vars.set %s: %w", name, err))
+		}
+
+		vu.shared.mu.Lock()
+		defer vu.shared.mu.Unlock()
+		vu.shared.vars[name] = data
+	})
+	rt.Set("vars", varsObj)
+
+	rt.Set("metric", func(name string, value float64) {
+		needWorker("metric")
+		vu.shared.record(name, value)
+	})
+
+	rt.Set("sleep", func(ms float64) {
+		needWorker("sleep")
+		if !sleepUntil(vu.ctx, time.Now().Add(time.Duration(ms*float64(time.Millisecond)))) {
+			throw(errTestOver)
+		}
+	})
+
+	rt.Set("log", func(args ...any) {
+		fmt.Println(append([]any{"script:"}, args...)...)
+	})
+}
+
+// scriptRequest stands for a script function in reports, for errors thrown
+// outside of a request.
+type scriptRequest struct {
+	function string
+}
+
+func (r *scriptRequest) GetURI() string {
+	return "script:" + r.function
+}
+
+func (r *scriptRequest) GetMethod() string {
+	return "SCRIPT"
+}
+
+func (r *scriptRequest) GetHeaders() http.Header {
+	return nil
+}
+
+func (r *scriptRequest) GetBody() []byte {
+	return nil
+}
+
+func (r *scriptRequest) GetName() string {
+	return "script " + r.function
+}
+
+func (r *scriptRequest) GetTags() []string {
+	return nil
+}
@@ -8,9 +8,11 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"net"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -25,194 +27,727 @@ const (
 	MIN_DURATION                   = 1 * time.Minute
 	MAX_DURATION                   = 60 * time.Minute
 	DEFAULT_COUNT_WORKERS          = 10
-	MAX_COUNT_WORKERS              = 100
+	MAX_COUNT_WORKERS              = 10000
 	DEFAULT_REQUEST_CHAN_BUF_SIZE  = 10
 	MAX_CHAN_BUF_SIZE              = 100
 	DEFAULT_RESPONSE_CHAN_BUF_SIZE = 10
-	REPORT_IN_CHAN_SIZE            = 100
 	REQUEST_TIMEOUT                = 10 * time.Second
+	TRANSPORT_POOL_SIZE            = 16
 )
 
-func StartSendingRequests(outCh chan<- *RequestInfo, reqsConfig *RequestsConfig, testCtx context.Context) []*RequestReport {
-	reqsConfig = setReqSettings(reqsConfig)
-	if reqsConfig.Requests == nil {
-		outCh <- &RequestInfo{Err: errors.New("No requests")}
+// engine holds everything shared by the workers of one test run. Workers are
+// plain goroutines, the heavy parts (transports, TLS config, token cache) are
+// created once and shared between them.
+type engine struct {
+	cfg         *RequestsConfig
+	ctx         context.Context
+	proxies     *proxyPool
+	tlsConfig   *tls.Config
+	transports  []*http.Transport
+	tokenClient *http.Client
+	auth        *authenticator
+	control     *TestControl
+	scripts     *scriptShared
+	publish     func(*RequestInfo)
+
+	// Running workers, retire[i] stops worker i.
+	seed    int64
+	spawned int64
+	retire  []chan struct{}
+	workers sync.WaitGroup
+	running atomic.Int64
+	exited  chan struct{}
+}
+
+// StartSendingRequests runs a test and passes every finished request to
+// outCh, requests that don't fit into outCh are dropped. Errors that keep the
+// test from starting are sent to outCh with a nil Request.
+func StartSendingRequests(outCh chan<- *RequestInfo, reqsConfig *RequestsConfig, testCtx context.Context) *TestReport {
+	report, err := runTest(reqsConfig, testCtx, SinkConfig{Sink: channelSink(outCh), Policy: DROP_WHEN_FULL})
+	// Errors of a test that ran are in the report, see runTest.
+	if report == nil {
+		outCh <- &RequestInfo{Err: err}
 		return nil
 	}
+	close(outCh)
+	return report
+}
 
-	var reportWg sync.WaitGroup
-	var sendingReqsWg sync.WaitGroup
-
-	reportOutCh := make(chan []*RequestReport, 1)
-	reportInCh := make(chan *RequestInfo, REPORT_IN_CHAN_SIZE)
+// runTest runs a test with the sinks of reqsConfig and the extra ones, it
+// returns once all sinks got the report. An error with a report means the
+// test ran, but the replay stopped early or the result log is incomplete.
+func runTest(reqsConfig *RequestsConfig, testCtx context.Context, extra ...SinkConfig) (*TestReport, error) {
+	reqsConfig, err := checkRequestsConfig(reqsConfig)
+	if err != nil {
+		return nil, err
+	}
+	sinkConfigs := append(append([]SinkConfig{}, reqsConfig.Sinks...), extra...)
+	if err := validateSinks(sinkConfigs); err != nil {
+		return nil, err
+	}
 
-	reportWg.Add(1)
-	go func() {
-		defer reportWg.Done()
-		reportOutCh <- reportPool(reportInCh)
-		close(reportOutCh)
-	}()
+	// The engine enforces the duration itself so pauses don't count.
+	runCtx, cancelRun := context.WithCancel(testCtx)
+	defer cancelRun()
 
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	e, err := newEngine(reqsConfig, runCtx)
+	if err != nil {
+		return nil, err
+	}
+	defer e.close()
 
-	for i := 0; i < int(reqsConfig.Count_Workers); i++ {
-		sendingReqsWg.Add(1)
+	var replay *replaySource
+	if reqsConfig.Replay != nil {
+		replay, err = openReplay(reqsConfig.Replay)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-		handleHTTP := func() {
-			defer sendingReqsWg.Done()
-			customTransport := &http.Transport{
-				TLSClientConfig:     &tls.Config{InsecureSkipVerify: reqsConfig.Secure},
-				MaxIdleConns:        MAX_COUNT_WORKERS,
-				MaxIdleConnsPerHost: MAX_COUNT_WORKERS,
+	var resultLog *ResultLog
+	if reqsConfig.ResultLog != "" {
+		resultLog, err = CreateResultLog(reqsConfig.ResultLog)
+		if err != nil {
+			if replay != nil {
+				replay.log.Close()
 			}
-			cl := http.Client{Transport: customTransport, Timeout: REQUEST_TIMEOUT}
+			return nil, err
+		}
+		sinkConfigs = append(sinkConfigs, SinkConfig{Sink: resultLog, Policy: BLOCK_WHEN_FULL})
+	}
 
-			ticker := time.NewTicker(reqsConfig.Delay)
-			defer ticker.Stop()
+	testReport := &TestReport{
+		Started:   time.Now(),
+		Config:    newRunConfig(reqsConfig),
+		ResultLog: reqsConfig.ResultLog,
+	}
+	testReport.ID = NewRunID(testReport.Started)
 
-			for {
-				select {
-				case <-testCtx.Done():
-					return
-				case <-ticker.C:
-					index := r.Intn(len(reqsConfig.Requests))
-					req, ok := reqsConfig.Requests[index].(*HTTPRequest)
-					if !ok {
-						outCh <- &RequestInfo{Request: req, Err: errors.New("Unsupported request type")}
-						return
-					}
-					cached := reqsConfig.Requests[index].GetBody()
-
-					reqCopy := req.Clone(testCtx)
-					if cached != nil {
-						reqCopy.Body = io.NopCloser(bytes.NewReader(cached))
-					}
-
-					start := time.Now()
-					resp, err := cl.Do(reqCopy)
-					if err != nil && strings.Contains(err.Error(), "context canceled") {
-						return
-					}
-
-					reqInf := &RequestInfo{
-						Time:    time.Since(start),
-						Request: req,
-						Err:     err,
-					}
-
-					if resp != nil {
-						body, _ := io.ReadAll(resp.Body)
-						resp.Body.Close()
-						reqInf.Response = &Response{Status: resp.StatusCode, Body: body, Headers: resp.Header}
-					}
-
-					select {
-					case outCh <- reqInf:
-					default:
-						fmt.Println("outCh is full, dropping request")
-					}
-
-					select {
-					case reportInCh <- reqInf:
-					default:
-						fmt.Println("reportInCh is full, dropping request")
-					}
+	e.control.start(testReport.Started, reqsConfig.Count_Workers, reqsConfig.Delay)
+	go e.control.enforceDuration(runCtx, reqsConfig.Duration, cancelRun)
+
+	reports := newReportAggregator(testReport.Started)
+	sinks := startSinks(sinkConfigs, &e.control.dropped)
+
+	e.publish = func(reqInf *RequestInfo) {
+		reqInf.Finished = time.Now()
+		reports.add(reqInf)
+		sinks.request(reqInf)
+	}
+
+	var runErr error
+	if replay != nil {
+		testReport.Events = []LoadEvent{{Workers: reqsConfig.Count_Workers, Delay: reqsConfig.Delay}}
+		replayErr := e.runReplay(replay, testReport.Started)
+		testReport.Replay = replay.close(reqsConfig.Replay)
+		if replayErr != nil {
+			testReport.Replay.Err = replayErr.Error()
+			runErr = fmt.Errorf("replay stopped early: %w", replayErr)
+		}
+	} else {
+		e.setWorkers(reqsConfig.Count_Workers)
+		testReport.Events = e.watchLoad(testReport.Started)
+	}
+
+	e.workers.Wait()
+	testReport.Metrics = e.scripts.result()
+	testReport.Requests, testReport.TimeSeries = reports.result()
+	testReport.Finished = time.Now()
+	testReport.Paused = e.control.PausedFor()
+
+	sinks.finish(testReport)
+	if resultLog != nil && resultLog.Err() != nil {
+		testReport.ResultLogErr = resultLog.Err().Error()
+		runErr = errors.Join(runErr, fmt.Errorf("result log: %w", resultLog.Err()))
+	}
+	return testReport, runErr
+}
+
+// checkRequestsConfig fills in the defaults and rejects configs the engine
+// can't run.
+func checkRequestsConfig(reqsConfig *RequestsConfig) (*RequestsConfig, error) {
+	reqsConfig, err := setReqSettings(reqsConfig)
+	if err != nil {
+		return nil, err
+	}
+	if reqsConfig.Requests == nil && len(reqsConfig.Scenario) > 0 {
+		reqsConfig.Requests = scenarioRequests(reqsConfig.Scenario)
+	}
+	if reqsConfig.Replay != nil {
+		if err := checkReplayConfig(reqsConfig.Replay, reqsConfig.Protocol); err != nil {
+			return nil, err
+		}
+		if len(reqsConfig.Scenario) > 0 || reqsConfig.Script != nil {
+			return nil, errors.New("Replay can't be combined with a scenario or a script")
+		}
+		return reqsConfig, nil
+	}
+	scripted := reqsConfig.Script != nil && reqsConfig.Script.HasIteration() && reqsConfig.Protocol == HTTP
+	if reqsConfig.Requests == nil && !scripted {
+		return nil, errors.New("No requests")
+	}
+	if reqsConfig.Protocol != HTTP && reqsConfig.Protocol != WS {
+		return nil, errors.New("Unsupported protocol")
+	}
+	if len(reqsConfig.Scenario) > 0 && reqsConfig.Protocol != HTTP {
+		return nil, errors.New("Scenarios are only supported for HTTP")
+	}
+	return reqsConfig, nil
+}
+
+func newEngine(reqsConfig *RequestsConfig, testCtx context.Context) (*engine, error) {
+	proxies, err := newProxyPool(reqsConfig.Proxy)
+	if err != nil {
+		return nil, err
+	}
 
+	tlsConfig, err := BuildTLSConfig(reqsConfig.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if reqsConfig.Secure {
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	tokenClient := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig.Clone()},
+		Timeout:   REQUEST_TIMEOUT,
+	}
+	auth, err := newAuthenticator(reqsConfig.Auth, tokenClient)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &engine{
+		cfg:         reqsConfig,
+		ctx:         testCtx,
+		proxies:     proxies,
+		tlsConfig:   tlsConfig,
+		tokenClient: tokenClient,
+		auth:        auth,
+		control:     reqsConfig.Control,
+	}
+	if e.control == nil {
+		e.control = NewTestControl()
+	}
+	e.seed = time.Now().UnixNano()
+	e.scripts = newScriptShared()
+	e.exited = make(chan struct{}, 1)
+
+	if reqsConfig.Protocol == HTTP {
+		e.transports = newTransportPool(tlsConfig, reqsConfig.Count_Workers)
+	}
+
+	return e, nil
+}
+
+// newTransportPool shares a few transports between all workers instead of
+// giving each worker its own. Idle connections are sized so every worker can
+// keep its connection alive.
+func newTransportPool(tlsConfig *tls.Config, countWorkers int) []*http.Transport {
+	size := min(countWorkers, TRANSPORT_POOL_SIZE)
+	workersPerTransport := (countWorkers + size - 1) / size
+
+	transports := make([]*http.Transport, size)
+	for i := range transports {
+		transports[i] = &http.Transport{
+			TLSClientConfig:        tlsConfig.Clone(),
+			MaxIdleConns:           workersPerTransport,
+			MaxIdleConnsPerHost:    workersPerTransport,
+			DialContext:            countingDialContext,
+			Proxy:                  proxyFromContext,
+			OnProxyConnectResponse: onProxyConnectResponse,
+		}
+	}
+
+	return transports
+}
+
+func (e *engine) close() {
+	for _, transport := range e.transports {
+		transport.CloseIdleConnections()
+	}
+	e.tokenClient.CloseIdleConnections()
+}
+
+// setWorkers starts or retires workers until n are running. Retired workers
+// finish their current request first.
+func (e *engine) setWorkers(n int) {
+	added := n - len(e.retire)
+	for i := 0; len(e.retire) < n; i++ {
+		id := len(e.retire)
+		retire := make(chan struct{})
+		e.retire = append(e.retire, retire)
+
+		// Spread the first requests over one delay period so thousands of
+		// workers don't fire on the same tick.
+		startOffset := time.Duration(int64(e.control.Delay()) * int64(i) / int64(added))
+		sched := newSchedule(time.Now().Add(startOffset), e.control, retire)
+		r := rand.New(rand.NewSource(e.seed + e.spawned))
+		e.spawned++
+
+		e.workers.Add(1)
+		e.running.Add(1)
+		go func() {
+			defer e.workers.Done()
+			defer func() {
+				e.running.Add(-1)
+				select {
+				case e.exited <- struct{}{}:
+				default:
 				}
+			}()
+
+			switch e.cfg.Protocol {
+			case HTTP:
+				e.runHTTPWorker(id, r, sched)
+			case WS:
+				e.runWSWorker(id, r, sched)
+			}
+		}()
+	}
+
+	for len(e.retire) > n {
+		last := len(e.retire) - 1
+		close(e.retire[last])
+		e.retire = e.retire[:last]
+	}
+}
+
+// watchLoad applies the load changes made through the control until the test
+// ends or every worker stopped, and returns them with the initial load first.
+func (e *engine) watchLoad(start time.Time) []LoadEvent {
+	workers, delay := e.cfg.Count_Workers, e.cfg.Delay
+	events := []LoadEvent{{Workers: workers, Delay: delay}}
+
+	for {
+		newWorkers, newDelay, changed := e.control.load()
+		if newWorkers != workers || newDelay != delay {
+			if newWorkers != workers {
+				e.setWorkers(newWorkers)
+			}
+			workers, delay = newWorkers, newDelay
+			events = append(events, LoadEvent{Time: time.Since(start), Workers: workers, Delay: delay})
+		}
+
+		select {
+		case <-e.ctx.Done():
+			return events
+		case <-changed:
+		case <-e.exited:
+			if e.running.Load() == 0 {
+				return events
 			}
 		}
+	}
+}
 
-		handleWebSocket := func() {
-			defer sendingReqsWg.Done()
+// newWorkerScript starts the script runtime of a worker and runs setup, vu
+// is nil without a script. ok is false when the worker should stop.
+func (e *engine) newWorkerScript(init func(vu *scriptVU)) (vu *scriptVU, ok bool) {
+	if e.cfg.Script == nil {
+		return nil, true
+	}
 
-			index := r.Intn(len(reqsConfig.Requests))
-			req, ok := reqsConfig.Requests[index].(*WSRequest)
-			if !ok {
-				outCh <- &RequestInfo{Request: req, Err: errors.New("Unsupported request type")}
-				return
+	vu, err := newScriptVU(e.cfg.Script, e.scripts)
+	if err != nil {
+		e.scriptFailed("load", &ScriptError{Function: "load", Err: err})
+		return nil, false
+	}
+	init(vu)
+
+	_, err = vu.call(e.ctx, "setup")
+	return vu, !e.scriptFailed("setup", err) && e.ctx.Err() == nil
+}
+
+// finishWorkerScript runs teardown, it gets a moment of its own as the test
+// is already over.
+func (e *engine) finishWorkerScript(vu *scriptVU) {
+	if !vu.has("teardown") {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), SCRIPT_TEARDOWN_TIMEOUT)
+	defer cancel()
+
+	_, err := vu.call(ctx, "teardown")
+	e.scriptFailed("teardown", err)
+}
+
+// scriptFailed publishes the exceptions of scripts, it reports whether err
+// is set.
+func (e *engine) scriptFailed(function string, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var scriptErr *ScriptError
+	if errors.As(err, &scriptErr) {
+		e.publish(&RequestInfo{Request: &scriptRequest{function: function}, Err: err})
+	}
+	return true
+}
+
+func (e *engine) workerAuth() *authenticator {
+	if e.cfg.Auth != nil && e.cfg.Auth.Cache == TOKEN_CACHE_PER_WORKER {
+		auth, _ := newAuthenticator(e.cfg.Auth, e.tokenClient)
+		return auth
+	}
+	return e.auth
+}
+
+func (e *engine) runHTTPWorker(id int, r *rand.Rand, sched *schedule) {
+	reqsConfig := e.cfg
+	testCtx := e.ctx
+	auth := e.workerAuth()
+
+	cl := &http.Client{
+		Transport: e.transports[id%len(e.transports)],
+		Timeout:   REQUEST_TIMEOUT,
+		Jar:       newCookieJar(reqsConfig.Cookies, reqsConfig.Requests),
+	}
+
+	// The first request of an iteration is due at the scheduled time, the
+	// ones a script sends after it right away.
+	var intended time.Time
+	vu, ok := e.newWorkerScript(func(vu *scriptVU) {
+		vu.sendHTTP = func(ctx context.Context, req *HTTPRequest) (*RequestInfo, bool) {
+			at := intended
+			if at.IsZero() {
+				at = time.Now()
 			}
+			intended = time.Time{}
 
-			dialer := websocket.Dialer{
-				TLSClientConfig:  &tls.Config{InsecureSkipVerify: reqsConfig.Secure},
-				HandshakeTimeout: REQUEST_TIMEOUT,
+			reqInf, ok := e.sendHTTP(ctx, id, cl, auth, req, sched, at)
+			if ok {
+				e.publish(reqInf)
 			}
+			return reqInf, ok
+		}
+	})
+	if !ok {
+		return
+	}
+	defer e.finishWorkerScript(vu)
 
-			conn, _, err := dialer.DialContext(testCtx, reqsConfig.Requests[index].GetURI(), reqsConfig.Requests[index].GetHeaders())
-			defer func() {
-				if conn != nil {
-					conn.Close()
-				}
-			}()
-			if err != nil {
-				if strings.Contains(err.Error(), "operation was canceled") {
-					return
-				}
-				outCh <- &RequestInfo{Request: req, Err: err}
+	for {
+		intended, ok = sched.wait(testCtx)
+		if !ok {
+			return
+		}
+
+		if reqsConfig.Cookies != nil && reqsConfig.Cookies.ResetPerIteration {
+			cl.Jar = newCookieJar(reqsConfig.Cookies, reqsConfig.Requests)
+		}
+
+		if vu.has("iteration") {
+			_, err := vu.call(testCtx, "iteration")
+			if testCtx.Err() != nil {
 				return
 			}
+			e.scriptFailed("iteration", err)
+			sched.skipTo(time.Now())
+			continue
+		}
 
-			ticker := time.NewTicker(reqsConfig.Delay)
-			defer ticker.Stop()
+		if len(reqsConfig.Scenario) > 0 {
+			if !e.runScenario(vu, id, cl, auth, sched, intended) {
+				return
+			}
+			continue
+		}
 
-			for {
-				select {
-				case <-testCtx.Done():
-					return
-				case <-ticker.C:
-					start := time.Now()
-
-					err := conn.WriteMessage(websocket.TextMessage, req.GetBody())
-					if err != nil {
-						outCh <- &RequestInfo{Request: req, Err: err}
-						return
-					}
-
-					msgType, msg, err := conn.ReadMessage()
-					if err != nil {
-						outCh <- &RequestInfo{Request: req, Err: err}
-						return
-					}
-
-					duration := time.Since(start)
-
-					reqInf := &RequestInfo{
-						Time:     duration,
-						Response: &Response{Status: msgType, Body: msg},
-						Request:  req,
-						Err:      err,
-					}
-
-					select {
-					case outCh <- reqInf:
-					default:
-						fmt.Println("outCh is full, dropping request")
-					}
-
-					select {
-					case reportInCh <- reqInf:
-					default:
-						fmt.Println("reportInCh is full, dropping request")
-					}
-				}
+		index := r.Intn(len(reqsConfig.Requests))
+		req, ok := reqsConfig.Requests[index].(*HTTPRequest)
+		if !ok {
+			e.publish(&RequestInfo{Request: reqsConfig.Requests[index], Err: errors.New("Unsupported request type"), Worker: id})
+			return
+		}
+
+		if !e.doHTTP(vu, id, cl, auth, req, sched, intended) {
+			return
+		}
+	}
+}
+
+// runScenario sends the scenario steps one after another. A step is due
+// Delay after the previous one was due, or once the previous one finished if
+// it took longer, so only the generator's own lag counts as late. The next
+// iteration starts on schedule or right away when the scenario overran it.
+func (e *engine) runScenario(vu *scriptVU, id int, cl *http.Client, auth *authenticator, sched *schedule, intended time.Time) bool {
+	var finished time.Time
+	for i, step := range e.cfg.Scenario {
+		if i > 0 {
+			intended = intended.Add(step.Delay)
+			if finished.After(intended) {
+				intended = finished
+			}
+			if !sleepUntil(e.ctx, intended) {
+				return false
+			}
+			waited, ok := e.control.wait(e.ctx)
+			if !ok {
+				return false
+			}
+			if waited {
+				intended = time.Now()
 			}
 		}
 
-		switch reqsConfig.Protocol {
-		case HTTP:
-			go handleHTTP()
-		case WS:
-			go handleWebSocket()
-		default:
-			outCh <- &RequestInfo{Err: errors.New("Unsupported protocol")}
-			return nil
+		if !e.doHTTP(vu, id, cl, auth, step.Request, sched, intended) {
+			return false
 		}
+		finished = time.Now()
+	}
+
+	sched.skipTo(time.Now())
+	return true
+}
 
+// doHTTP sends a configured request through the script hooks and publishes
+// the result, ok is false when the test is over.
+func (e *engine) doHTTP(vu *scriptVU, id int, cl *http.Client, auth *authenticator, req *HTTPRequest, sched *schedule, intended time.Time) bool {
+	sent, skip, err := vu.beforeRequest(e.ctx, req)
+	if e.ctx.Err() != nil {
+		return false
+	}
+	if e.scriptFailed("beforeRequest", err) || skip {
+		return true
 	}
 
-	sendingReqsWg.Wait()
-	close(reportInCh)
-	close(outCh)
-	reportWg.Wait()
+	reqInf, ok := e.sendHTTP(e.ctx, id, cl, auth, sent, sched, intended)
+	if !ok {
+		return false
+	}
+
+	err = vu.afterResponse(e.ctx, reqInf)
+	if e.ctx.Err() != nil {
+		return false
+	}
+	e.scriptFailed("afterResponse", err)
+
+	// Reports keep the configured request, whatever the script changed.
+	reqInf.Request = req
+	e.publish(reqInf)
+	return true
+}
+
+// sendHTTP sends one request, ok is false when the test is over.
+func (e *engine) sendHTTP(ctx context.Context, id int, cl *http.Client, auth *authenticator, req *HTTPRequest, sched *schedule, intended time.Time) (*RequestInfo, bool) {
+	cached := req.GetBody()
+
+	proxyURL := e.proxies.pick(id)
+	reqCopy := req.Clone(withProxy(ctx, proxyURL))
+	if cached != nil {
+		reqCopy.Body = io.NopCloser(bytes.NewReader(cached))
+	}
+
+	if err := auth.authorize(ctx, reqCopy.Header); err != nil {
+		if ctx.Err() != nil {
+			return nil, false
+		}
+		return &RequestInfo{Request: req, Err: err, Worker: id}, true
+	}
+
+	traceCtx, tracer := withPhaseTrace(reqCopy.Context())
+	reqCopy = reqCopy.WithContext(traceCtx)
+
+	start := time.Now()
+	resp, err := cl.Do(reqCopy)
+	if err != nil && strings.Contains(err.Error(), "context canceled") {
+		return nil, false
+	}
+	err = wrapProxyError(err, proxyURL)
+	if err == nil && proxyURL != nil && resp.StatusCode == http.StatusProxyAuthRequired {
+		err = &ProxyError{Proxy: proxyURL.Redacted(), Err: errors.New(resp.Status)}
+	}
+
+	reqInf := &RequestInfo{
+		Time:    time.Since(start),
+		Request: req,
+		Err:     err,
+		Cookies: countCookies(cl.Jar, req.GetURI()),
+		Worker:  id,
+	}
+	sched.mark(reqInf, intended, start)
+
+	if resp != nil {
+		var body []byte
+		var bodySize int64
+		if e.cfg.DiscardBody {
+			bodySize, _ = io.Copy(io.Discard, resp.Body)
+		} else {
+			body, _ = io.ReadAll(resp.Body)
+			bodySize = int64(len(body))
+		}
+		resp.Body.Close()
+
+		reqInf.Response = &Response{Status: resp.StatusCode, Body: body, Headers: resp.Header}
+		reqInf.Phases = tracer.done()
+		reqInf.BytesSent, reqInf.BytesReceived = tracer.traffic()
+		reqInf.BodySize = bodySize
+	}
+
+	return reqInf, true
+}
+
+func (e *engine) runWSWorker(id int, r *rand.Rand, sched *schedule) {
+	reqsConfig := e.cfg
+	testCtx := e.ctx
+	auth := e.workerAuth()
+
+	index := r.Intn(len(reqsConfig.Requests))
+	req, ok := reqsConfig.Requests[index].(*WSRequest)
+	if !ok {
+		e.publish(&RequestInfo{Request: reqsConfig.Requests[index], Err: errors.New("Unsupported request type"), Worker: id})
+		return
+	}
+
+	dialer := websocket.Dialer{
+		TLSClientConfig:  e.tlsConfig.Clone(),
+		HandshakeTimeout: REQUEST_TIMEOUT,
+		Jar:              newCookieJar(reqsConfig.Cookies, reqsConfig.Requests),
+	}
+	if proxyURL := e.proxies.pick(id); proxyURL != nil {
+		dialer.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialViaProxy(ctx, proxyURL, network, addr)
+		}
+	}
+
+	headers := req.GetHeaders().Clone()
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	if err := auth.authorize(testCtx, headers); err != nil {
+		if testCtx.Err() == nil {
+			e.publish(&RequestInfo{Request: req, Err: err, Worker: id})
+		}
+		return
+	}
+
+	conn, _, err := dialer.DialContext(testCtx, req.GetURI(), headers)
+	if err != nil {
+		if strings.Contains(err.Error(), "operation was canceled") {
+			return
+		}
+		e.publish(&RequestInfo{Request: req, Err: err, Worker: id})
+		return
+	}
+	defer conn.Close()
+
+	// ReadMessage doesn't watch the context, closing the connection unblocks it.
+	stop := context.AfterFunc(testCtx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	var intended time.Time
+	broken := false
+	send := func(payload []byte) (*RequestInfo, bool) {
+		at := intended
+		if at.IsZero() {
+			at = time.Now()
+		}
+		intended = time.Time{}
+
+		reqInf, ok := e.sendWS(conn, dialer.Jar, req, payload, sched, at)
+		if reqInf != nil {
+			reqInf.Worker = id
+		}
+		broken = !ok
+		return reqInf, ok
+	}
+
+	vu, ok := e.newWorkerScript(func(vu *scriptVU) {
+		vu.sendWS = func(ctx context.Context, payload []byte) (*RequestInfo, bool) {
+			reqInf, ok := send(payload)
+			if reqInf != nil {
+				e.publish(reqInf)
+			}
+			return reqInf, ok
+		}
+	})
+	if !ok {
+		return
+	}
+	defer e.finishWorkerScript(vu)
+
+	for {
+		intended, ok = sched.wait(testCtx)
+		if !ok {
+			return
+		}
+
+		if vu.has("iteration") {
+			_, err := vu.call(testCtx, "iteration")
+			if testCtx.Err() != nil || broken {
+				return
+			}
+			e.scriptFailed("iteration", err)
+			sched.skipTo(time.Now())
+			continue
+		}
+
+		payload, skip, err := vu.beforeMessage(testCtx, req, req.GetBody())
+		if testCtx.Err() != nil {
+			return
+		}
+		if e.scriptFailed("beforeRequest", err) || skip {
+			continue
+		}
+
+		reqInf, ok := send(payload)
+		if reqInf == nil {
+			return
+		}
+
+		err = vu.afterResponse(testCtx, reqInf)
+		if testCtx.Err() != nil {
+			return
+		}
+		e.scriptFailed("afterResponse", err)
+
+		e.publish(reqInf)
+		if !ok {
+			return
+		}
+	}
+}
+
+// sendWS sends one message and waits for the reply. ok is false when the
+// connection can't be used anymore, reqInf is nil when the test is over.
+func (e *engine) sendWS(conn *websocket.Conn, jar http.CookieJar, req *WSRequest, payload []byte, sched *schedule, intended time.Time) (*RequestInfo, bool) {
+	start := time.Now()
+
+	err := conn.WriteMessage(websocket.TextMessage, payload)
+	if err != nil {
+		if e.ctx.Err() != nil {
+			return nil, false
+		}
+		return &RequestInfo{Request: req, Err: err}, false
+	}
+
+	msgType, msg, err := conn.ReadMessage()
+	if err != nil {
+		if e.ctx.Err() != nil {
+			return nil, false
+		}
+		return &RequestInfo{Request: req, Err: err}, false
+	}
+
+	reqInf := &RequestInfo{
+		Time:          time.Since(start),
+		Response:      &Response{Status: msgType, Body: msg},
+		Request:       req,
+		Cookies:       countCookies(jar, req.GetURI()),
+		BytesSent:     int64(len(payload)),
+		BytesReceived: int64(len(msg)),
+		BodySize:      int64(len(msg)),
+	}
+	if e.cfg.DiscardBody {
+		reqInf.Response.Body = nil
+	}
+	sched.mark(reqInf, intended, start)
 
-	return <-reportOutCh
+	return reqInf, true
 }
@@ -0,0 +1,286 @@
+package core
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DEFAULT_SINK_BUF_SIZE = 1000
+	MAX_SINK_BUF_SIZE     = 1000000
+)
+
+type SinkPolicy int
+
+const (
+	// BLOCK_WHEN_FULL makes the workers wait for the sink, nothing is lost.
+	BLOCK_WHEN_FULL SinkPolicy = iota
+	// DROP_WHEN_FULL drops what doesn't fit into the buffer of the sink.
+	DROP_WHEN_FULL
+)
+
+func (p SinkPolicy) String() string {
+	return [...]string{"Block when full", "Drop when full"}[p]
+}
+
+// Sink consumes the results of a test. Every sink is called from its own
+// goroutine in order: OnRequest for every finished request,
+// OnIntervalSnapshot once per TIME_SERIES_INTERVAL and OnFinish once with the
+// report. OnFinish isn't called when the test couldn't start.
+type Sink interface {
+	OnRequest(reqInf *RequestInfo)
+	OnIntervalSnapshot(point TimeSeriesPoint)
+	OnFinish(report *TestReport)
+}
+
+// SinkConfig registers a sink, the buffer holds DEFAULT_SINK_BUF_SIZE
+// results when BufferSize is 0.
+type SinkConfig struct {
+	Sink       Sink
+	Policy     SinkPolicy
+	BufferSize int
+}
+
+// SinkFuncs is a Sink made of functions, nil ones are skipped.
+type SinkFuncs struct {
+	Request  func(reqInf *RequestInfo)
+	Interval func(point TimeSeriesPoint)
+	Finish   func(report *TestReport)
+}
+
+func (s SinkFuncs) OnRequest(reqInf *RequestInfo) {
+	if s.Request != nil {
+		s.Request(reqInf)
+	}
+}
+
+func (s SinkFuncs) OnIntervalSnapshot(point TimeSeriesPoint) {
+	if s.Interval != nil {
+		s.Interval(point)
+	}
+}
+
+func (s SinkFuncs) OnFinish(report *TestReport) {
+	if s.Finish != nil {
+		s.Finish(report)
+	}
+}
+
+// channelSink passes the requests to the outCh of StartSendingRequests
+// without waiting for the reader, a full channel counts as a drop.
+type channelSink chan<- *RequestInfo
+
+// offerer is a sink that can refuse a request instead of blocking.
+type offerer interface {
+	offer(reqInf *RequestInfo) bool
+}
+
+func (s channelSink) offer(reqInf *RequestInfo) bool {
+	select {
+	case s <- reqInf:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s channelSink) OnRequest(reqInf *RequestInfo) {
+	s <- reqInf
+}
+
+func (s channelSink) OnIntervalSnapshot(TimeSeriesPoint) {}
+
+func (s channelSink) OnFinish(*TestReport) {}
+
+func validateSinks(sinks []SinkConfig) error {
+	for i, sink := range sinks {
+		if sink.Sink == nil {
+			return fmt.Errorf("sink %d is nil", i)
+		}
+		if sink.Policy != BLOCK_WHEN_FULL && sink.Policy != DROP_WHEN_FULL {
+			return fmt.Errorf("sink %d has an unknown policy %d", i, sink.Policy)
+		}
+		if sink.BufferSize < 0 || sink.BufferSize > MAX_SINK_BUF_SIZE {
+			return fmt.Errorf("sink buffer size must be between 0 and %d, got %d", MAX_SINK_BUF_SIZE, sink.BufferSize)
+		}
+	}
+	return nil
+}
+
+type sinkEvent struct {
+	request  *RequestInfo
+	interval *TimeSeriesPoint
+	report   *TestReport
+	// synced is closed once the sink got everything queued before it.
+	synced chan struct{}
+}
+
+type sinkRunner struct {
+	cfg   SinkConfig
+	queue chan sinkEvent
+	done  chan struct{}
+	// total counts the drops of all sinks of the test.
+	total *atomic.Int64
+}
+
+func startSink(cfg SinkConfig, total *atomic.Int64) *sinkRunner {
+	size := cfg.BufferSize
+	if size == 0 {
+		size = DEFAULT_SINK_BUF_SIZE
+	}
+	s := &sinkRunner{
+		cfg:   cfg,
+		queue: make(chan sinkEvent, size),
+		done:  make(chan struct{}),
+		total: total,
+	}
+	go s.loop()
+	return s
+}
+
+func (s *sinkRunner) loop() {
+	defer close(s.done)
+	for event := range s.queue {
+		switch {
+		case event.request != nil:
+			if o, ok := s.cfg.Sink.(offerer); ok {
+				if !o.offer(event.request) {
+					s.drop()
+				}
+				continue
+			}
+			s.cfg.Sink.OnRequest(event.request)
+		case event.interval != nil:
+			s.cfg.Sink.OnIntervalSnapshot(*event.interval)
+		case event.report != nil:
+			s.cfg.Sink.OnFinish(event.report)
+		case event.synced != nil:
+			close(event.synced)
+		}
+	}
+}
+
+func (s *sinkRunner) push(event sinkEvent) {
+	if s.cfg.Policy == BLOCK_WHEN_FULL {
+		s.queue <- event
+		return
+	}
+	select {
+	case s.queue <- event:
+	default:
+		// Only requests count as dropped results, a missed interval is
+		// still in the report.
+		if event.request != nil {
+			s.drop()
+		}
+	}
+}
+
+func (s *sinkRunner) drop() {
+	s.total.Add(1)
+}
+
+// sync waits until the sink handled all queued events.
+func (s *sinkRunner) sync() {
+	synced := make(chan struct{})
+	s.queue <- sinkEvent{synced: synced}
+	<-synced
+}
+
+// finish always delivers the report, then waits for the sink to drain.
+func (s *sinkRunner) finish(report *TestReport) {
+	if report != nil {
+		s.queue <- sinkEvent{report: report}
+	}
+	close(s.queue)
+	<-s.done
+}
+
+// sinkSet fans the results out to all sinks and sums them per interval.
+type sinkSet struct {
+	sinks     []*sinkRunner
+	intervals chan *RequestInfo
+	done      chan struct{}
+	dropped   *atomic.Int64
+}
+
+func startSinks(configs []SinkConfig, dropped *atomic.Int64) *sinkSet {
+	set := &sinkSet{
+		intervals: make(chan *RequestInfo, DEFAULT_SINK_BUF_SIZE),
+		done:      make(chan struct{}),
+		dropped:   dropped,
+	}
+	for _, cfg := range configs {
+		set.sinks = append(set.sinks, startSink(cfg, dropped))
+	}
+	go set.intervalLoop()
+	return set
+}
+
+func (set *sinkSet) request(reqInf *RequestInfo) {
+	if len(set.sinks) == 0 {
+		return
+	}
+	set.intervals <- reqInf
+	for _, s := range set.sinks {
+		s.push(sinkEvent{request: reqInf})
+	}
+}
+
+// finish passes the last interval and the report, then waits for all sinks.
+// Nothing is dropped once the sinks are synced, so the report gets the final
+// count.
+func (set *sinkSet) finish(report *TestReport) {
+	close(set.intervals)
+	<-set.done
+	for _, s := range set.sinks {
+		s.sync()
+	}
+	report.Dropped = set.dropped.Load()
+	for _, s := range set.sinks {
+		s.finish(report)
+	}
+}
+
+func (set *sinkSet) intervalLoop() {
+	defer close(set.done)
+
+	ticker := time.NewTicker(TIME_SERIES_INTERVAL)
+	defer ticker.Stop()
+
+	point := TimeSeriesPoint{}
+	var sum time.Duration
+
+	flush := func() {
+		if point.Requests > 0 {
+			point.AvgTime = sum / time.Duration(point.Requests)
+		}
+		for _, s := range set.sinks {
+			p := point
+			s.push(sinkEvent{interval: &p})
+		}
+		point = TimeSeriesPoint{Time: point.Time + TIME_SERIES_INTERVAL}
+		sum = 0
+	}
+
+	for {
+		select {
+		case reqInf, ok := <-set.intervals:
+			if !ok {
+				if point.Requests > 0 {
+					flush()
+				}
+				return
+			}
+			point.Requests++
+			if reqInf.Err != nil {
+				point.Errors++
+			}
+			point.BytesReceived += reqInf.BytesReceived
+			sum += reqInf.Time
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
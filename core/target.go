@@ -0,0 +1,397 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	DEFAULT_TARGET_ADDR          = "127.0.0.1:8090"
+	DEFAULT_TARGET_PUSH_INTERVAL = time.Second
+	MAX_TARGET_DELAY             = time.Minute
+	MAX_TARGET_BODY_SIZE         = 10 << 20
+	TARGET_SHUTDOWN_TIMEOUT      = 5 * time.Second
+)
+
+const TARGET_HELP = `TestYourServer target
+
+Endpoints:
+  /echo      echoes the method, path, query, headers and body as JSON
+  /stats     requests received since the start
+  /ws/echo   WebSocket, echoes every message
+  /ws/push   WebSocket, sends a message every interval
+
+Query parameters:
+  delay=250ms       wait before answering (a plain number is milliseconds)
+  status=503        answer /echo with this status code
+  fail=0.1          share of requests answered with 500
+  size=1024         answer with a body of this many bytes instead of the echo
+  interval=100ms    push interval of /ws/push
+`
+
+// TargetConfig configures the built-in target server, the query parameters
+// of a request override it.
+type TargetConfig struct {
+	Addr         string
+	Delay        time.Duration
+	FailureRate  float64
+	PushInterval time.Duration
+}
+
+// TargetServer is a local server to calibrate the tool against and to see
+// how it reports delays, errors and failures.
+type TargetServer struct {
+	cfg      TargetConfig
+	server   *http.Server
+	listener net.Listener
+	started  time.Time
+	requests atomic.Int64
+	upgrader websocket.Upgrader
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+	// conns are the open WebSocket connections, Close closes them.
+	conns  map[*websocket.Conn]struct{}
+	closed bool
+}
+
+func ValidateTargetConfig(cfg *TargetConfig) error {
+	if cfg.Delay < 0 || cfg.Delay > MAX_TARGET_DELAY {
+		return fmt.Errorf("target delay must be between 0 and %v, got %v", MAX_TARGET_DELAY, cfg.Delay)
+	}
+	if cfg.FailureRate < 0 || cfg.FailureRate > 1 {
+		return fmt.Errorf("failure rate must be between 0 and 1, got %v", cfg.FailureRate)
+	}
+	if cfg.PushInterval < 0 {
+		return fmt.Errorf("push interval must not be negative, got %v", cfg.PushInterval)
+	}
+	return nil
+}
+
+// StartTarget listens on cfg.Addr and serves in the background until Close.
+func StartTarget(cfg TargetConfig) (*TargetServer, error) {
+	if err := ValidateTargetConfig(&cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Addr == "" {
+		cfg.Addr = DEFAULT_TARGET_ADDR
+	}
+	if cfg.PushInterval == 0 {
+		cfg.PushInterval = DEFAULT_TARGET_PUSH_INTERVAL
+	}
+
+	listener, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &TargetServer{
+		cfg:      cfg,
+		listener: listener,
+		started:  time.Now(),
+		rnd:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		conns:    make(map[*websocket.Conn]struct{}),
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", t.handleHelp)
+	mux.HandleFunc("/echo", t.handleEcho)
+	mux.HandleFunc("/stats", t.handleStats)
+	mux.HandleFunc("/ws/echo", t.handleWSEcho)
+	mux.HandleFunc("/ws/push", t.handleWSPush)
+	t.server = &http.Server{Handler: mux, ReadHeaderTimeout: REQUEST_TIMEOUT}
+
+	go func() {
+		if err := t.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Println("target server stopped:", err)
+		}
+	}()
+
+	return t, nil
+}
+
+// URL is the base URL of the server, WSURL the same for WebSocket.
+func (t *TargetServer) URL() string {
+	return "http://" + t.listener.Addr().String()
+}
+
+func (t *TargetServer) WSURL() string {
+	return "ws://" + t.listener.Addr().String()
+}
+
+// Requests is the number of requests and WebSocket messages received.
+func (t *TargetServer) Requests() int64 {
+	return t.requests.Load()
+}
+
+func (t *TargetServer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), TARGET_SHUTDOWN_TIMEOUT)
+	defer cancel()
+
+	// Shutdown doesn't wait for hijacked WebSocket connections, they are
+	// closed here so /ws/push stops sending.
+	err := t.server.Shutdown(ctx)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	for conn := range t.conns {
+		conn.Close()
+	}
+	return err
+}
+
+// upgrade switches to WebSocket and tracks the connection until release.
+func (t *TargetServer) upgrade(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
+	conn, err := t.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		conn.Close()
+		return nil, errors.New("target server closed")
+	}
+	t.conns[conn] = struct{}{}
+	return conn, nil
+}
+
+func (t *TargetServer) release(conn *websocket.Conn) {
+	t.mu.Lock()
+	delete(t.conns, conn)
+	t.mu.Unlock()
+	conn.Close()
+}
+
+// targetBehaviour is what a request asked for through its query.
+type targetBehaviour struct {
+	delay    time.Duration
+	status   int
+	fail     float64
+	size     int
+	interval time.Duration
+}
+
+func (t *TargetServer) behaviour(r *http.Request) (targetBehaviour, error) {
+	b := targetBehaviour{
+		delay:    t.cfg.Delay,
+		status:   http.StatusOK,
+		fail:     t.cfg.FailureRate,
+		size:     -1,
+		interval: t.cfg.PushInterval,
+	}
+	query := r.URL.Query()
+
+	var err error
+	if value := query.Get("delay"); value != "" {
+		if b.delay, err = parseTargetDuration(value); err != nil || b.delay < 0 || b.delay > MAX_TARGET_DELAY {
+			return b, fmt.Errorf("delay must be between 0 and %v", MAX_TARGET_DELAY)
+		}
+	}
+	if value := query.Get("status"); value != "" {
+		if b.status, err = strconv.Atoi(value); err != nil || b.status < 100 || b.status > 599 {
+			return b, errors.New("status must be between 100 and 599")
+		}
+	}
+	if value := query.Get("fail"); value != "" {
+		if b.fail, err = strconv.ParseFloat(value, 64); err != nil || b.fail < 0 || b.fail > 1 {
+			return b, errors.New("fail must be between 0 and 1")
+		}
+	}
+	if value := query.Get("size"); value != "" {
+		if b.size, err = strconv.Atoi(value); err != nil || b.size < 0 || b.size > MAX_TARGET_BODY_SIZE {
+			return b, fmt.Errorf("size must be between 0 and %d", MAX_TARGET_BODY_SIZE)
+		}
+	}
+	if value := query.Get("interval"); value != "" {
+		if b.interval, err = parseTargetDuration(value); err != nil || b.interval <= 0 {
+			return b, errors.New("interval must be positive")
+		}
+	}
+
+	return b, nil
+}
+
+// parseTargetDuration accepts Go durations and plain milliseconds.
+func parseTargetDuration(value string) (time.Duration, error) {
+	if ms, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(ms * float64(time.Millisecond)), nil
+	}
+	return time.ParseDuration(value)
+}
+
+func (t *TargetServer) failed(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rnd.Float64() < rate
+}
+
+// targetWait sleeps for the delay, it returns false when the client went away.
+func targetWait(ctx context.Context, delay time.Duration) bool {
+	return delay <= 0 || sleepUntil(ctx, time.Now().Add(delay))
+}
+
+func (t *TargetServer) handleHelp(w http.ResponseWriter, r *http.Request) {
+	t.requests.Add(1)
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, TARGET_HELP)
+}
+
+func (t *TargetServer) handleEcho(w http.ResponseWriter, r *http.Request) {
+	t.requests.Add(1)
+
+	b, err := t.behaviour(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, MAX_TARGET_BODY_SIZE))
+	if err != nil {
+		return
+	}
+	if !targetWait(r.Context(), b.delay) {
+		return
+	}
+	if t.failed(b.fail) {
+		http.Error(w, "random failure", http.StatusInternalServerError)
+		return
+	}
+
+	if b.size >= 0 {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.WriteHeader(b.status)
+		w.Write([]byte(strings.Repeat("x", b.size)))
+		return
+	}
+
+	headers := make(map[string]string, len(r.Header))
+	for key := range r.Header {
+		headers[key] = r.Header.Get(key)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(b.status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"method":  r.Method,
+		"path":    r.URL.Path,
+		"query":   r.URL.RawQuery,
+		"headers": headers,
+		"body":    string(body),
+	})
+}
+
+func (t *TargetServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"requests": t.requests.Load(),
+		"uptime":   time.Since(t.started).Round(time.Millisecond).String(),
+	})
+}
+
+func (t *TargetServer) handleWSEcho(w http.ResponseWriter, r *http.Request) {
+	b, err := t.behaviour(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	conn, err := t.upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer t.release(conn)
+
+	for {
+		msgType, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		t.requests.Add(1)
+
+		if !targetWait(r.Context(), b.delay) {
+			return
+		}
+		if t.failed(b.fail) {
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "random failure"))
+			return
+		}
+		if b.size >= 0 {
+			msg = []byte(strings.Repeat("x", b.size))
+		}
+		if err := conn.WriteMessage(msgType, msg); err != nil {
+			return
+		}
+	}
+}
+
+func (t *TargetServer) handleWSPush(w http.ResponseWriter, r *http.Request) {
+	b, err := t.behaviour(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	conn, err := t.upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer t.release(conn)
+
+	// Messages from the client are counted and otherwise ignored, the read
+	// loop notices when the client leaves.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+			t.requests.Add(1)
+		}
+	}()
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for seq := 1; ; seq++ {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if t.failed(b.fail) {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "random failure"))
+				return
+			}
+			msg := fmt.Sprintf(`{"seq":%d,"time":%q}`, seq, now.Format(time.RFC3339Nano))
+			if b.size >= 0 {
+				msg = strings.Repeat("x", b.size)
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+				return
+			}
+		}
+	}
+}
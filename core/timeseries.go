@@ -0,0 +1,79 @@
+package core
+
+import (
+	"time"
+)
+
+const (
+	TIME_SERIES_INTERVAL = time.Second
+)
+
+type TimeSeriesPoint struct {
+	// Offset from the start of the test
+	Time          time.Duration
+	Requests      int
+	Errors        int
+	AvgTime       time.Duration
+	BytesReceived int64
+}
+
+type timeSeries struct {
+	start  time.Time
+	points []*TimeSeriesPoint
+	sums   []time.Duration
+}
+
+func newTimeSeries(start time.Time) *timeSeries {
+	return &timeSeries{start: start}
+}
+
+func (ts *timeSeries) add(req *RequestInfo) {
+	finished := time.Now()
+	if !req.Scheduled.IsZero() {
+		finished = req.Scheduled.Add(req.Lag + req.Time)
+	}
+
+	index := max(int(finished.Sub(ts.start)/TIME_SERIES_INTERVAL), 0)
+	for len(ts.points) <= index {
+		ts.points = append(ts.points, &TimeSeriesPoint{Time: time.Duration(len(ts.points)) * TIME_SERIES_INTERVAL})
+		ts.sums = append(ts.sums, 0)
+	}
+
+	point := ts.points[index]
+	point.Requests++
+	if req.Err != nil {
+		point.Errors++
+	}
+	point.BytesReceived += req.BytesReceived
+
+	ts.sums[index] += req.Time
+	point.AvgTime = ts.sums[index] / time.Duration(point.Requests)
+}
+
+func (ts *timeSeries) result() []TimeSeriesPoint {
+	result := make([]TimeSeriesPoint, len(ts.points))
+	for i, point := range ts.points {
+		result[i] = *point
+	}
+	return result
+}
+
+// merge adds the points of other, both must have the same start.
+func (ts *timeSeries) merge(other *timeSeries) {
+	for len(ts.points) < len(other.points) {
+		ts.points = append(ts.points, &TimeSeriesPoint{Time: time.Duration(len(ts.points)) * TIME_SERIES_INTERVAL})
+		ts.sums = append(ts.sums, 0)
+	}
+
+	for i, point := range other.points {
+		total := ts.points[i]
+		total.Requests += point.Requests
+		total.Errors += point.Errors
+		total.BytesReceived += point.BytesReceived
+
+		ts.sums[i] += other.sums[i]
+		if total.Requests > 0 {
+			total.AvgTime = ts.sums[i] / time.Duration(total.Requests)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package core
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	TLS_SESSION_CACHE_SIZE = 64
+)
+
+type TLSConfig struct {
+	InsecureSkipVerify bool
+	CertFile           string
+	KeyFile            string
+	CAFile             string
+	ServerName         string
+	MinVersion         uint16
+	MaxVersion         uint16
+	CipherSuites       []uint16
+	SessionResumption  bool
+}
+
+var TLSVersions = []uint16{
+	tls.VersionTLS10,
+	tls.VersionTLS11,
+	tls.VersionTLS12,
+	tls.VersionTLS13,
+}
+
+func ParseTLSVersion(name string) (uint16, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return 0, nil
+	}
+
+	for _, version := range TLSVersions {
+		if tls.VersionName(version) == name {
+			return version, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown TLS version: %s", name)
+}
+
+// configurableCipherSuites are the suites of TLS 1.2 and older, crypto/tls
+// ignores CipherSuites for TLS 1.3 and always picks the 1.3 suites itself.
+func configurableCipherSuites() []*tls.CipherSuite {
+	suites := make([]*tls.CipherSuite, 0)
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		if !tls13Only(suite) {
+			suites = append(suites, suite)
+		}
+	}
+	return suites
+}
+
+func tls13Only(suite *tls.CipherSuite) bool {
+	for _, version := range suite.SupportedVersions {
+		if version != tls.VersionTLS13 {
+			return false
+		}
+	}
+	return true
+}
+
+func CipherSuiteNames() []string {
+	names := make([]string, 0)
+	for _, suite := range configurableCipherSuites() {
+		names = append(names, suite.Name)
+	}
+	return names
+}
+
+func ParseCipherSuites(list string) ([]uint16, error) {
+	ids := make([]uint16, 0)
+
+	for _, name := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' }) {
+		found := false
+		for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			if suite.Name != name {
+				continue
+			}
+			if tls13Only(suite) {
+				return nil, fmt.Errorf("%s is a TLS 1.3 cipher suite, TLS 1.3 suites can't be configured", name)
+			}
+			ids = append(ids, suite.ID)
+			found = true
+			break
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown cipher suite: %s", name)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	return ids, nil
+}
+
+// BuildTLSConfig turns the user settings into a tls.Config shared by the HTTP
+// transports and the WebSocket dialers.
+func BuildTLSConfig(cfg *TLSConfig) (*tls.Config, error) {
+	if cfg == nil {
+		return &tls.Config{}, nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		ServerName:         cfg.ServerName,
+		MinVersion:         cfg.MinVersion,
+		MaxVersion:         cfg.MaxVersion,
+		CipherSuites:       cfg.CipherSuites,
+	}
+
+	if cfg.MinVersion != 0 && cfg.MaxVersion != 0 && cfg.MinVersion > cfg.MaxVersion {
+		return nil, errors.New("minimum TLS version is greater than maximum")
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return nil, errors.New("both client certificate and key files are required")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.CAFile != "" {
+		caPEM, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("no certificates found in CA file")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.SessionResumption {
+		tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(TLS_SESSION_CACHE_SIZE)
+	} else {
+		tlsConfig.SessionTicketsDisabled = true
+	}
+
+	return tlsConfig, nil
+}
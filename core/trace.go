@@ -0,0 +1,125 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+type ConnPhases struct {
+	DNS      time.Duration
+	Connect  time.Duration
+	TLS      time.Duration
+	TTFB     time.Duration
+	Transfer time.Duration
+	Reused   bool
+}
+
+type PhaseReport struct {
+	AvgDNS      time.Duration
+	AvgConnect  time.Duration
+	AvgTLS      time.Duration
+	AvgTTFB     time.Duration
+	AvgTransfer time.Duration
+	NewConns    int
+	ReusedConns int
+}
+
+type phaseTracer struct {
+	mu           sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	firstByte    time.Time
+	phases       ConnPhases
+	conn         *countingConn
+	read0        int64
+	written0     int64
+}
+
+// withPhaseTrace attaches an httptrace to ctx, the returned tracer collects
+// the connection phases of a single request.
+func withPhaseTrace(ctx context.Context) (context.Context, *phaseTracer) {
+	t := &phaseTracer{start: time.Now()}
+
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			t.dnsStart = time.Now()
+			t.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			t.phases.DNS = time.Since(t.dnsStart)
+			t.mu.Unlock()
+		},
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+			t.mu.Unlock()
+		},
+		ConnectDone: func(string, string, error) {
+			t.mu.Lock()
+			t.phases.Connect = time.Since(t.connectStart)
+			t.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			t.tlsStart = time.Now()
+			t.mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			t.phases.TLS = time.Since(t.tlsStart)
+			t.mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.phases.Reused = info.Reused
+			if t.conn = asCountingConn(info.Conn); t.conn != nil {
+				t.read0 = t.conn.read.Load()
+				t.written0 = t.conn.written.Load()
+			}
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			t.firstByte = time.Now()
+			t.phases.TTFB = t.firstByte.Sub(t.start)
+			t.mu.Unlock()
+		},
+	}
+
+	return httptrace.WithClientTrace(ctx, trace), t
+}
+
+// done is called after the response body has been read.
+func (t *phaseTracer) done() *ConnPhases {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	phases := t.phases
+	if !t.firstByte.IsZero() {
+		phases.Transfer = time.Since(t.firstByte)
+	}
+
+	return &phases
+}
+
+// traffic returns the bytes sent and received on the connection since the
+// request got it.
+func (t *phaseTracer) traffic() (int64, int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn == nil {
+		return 0, 0
+	}
+
+	return t.conn.written.Load() - t.written0, t.conn.read.Load() - t.read0
+}
@@ -0,0 +1,51 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DIAL_TIMEOUT    = 30 * time.Second
+	DIAL_KEEP_ALIVE = 30 * time.Second
+)
+
+// countingConn counts the bytes that go over the wire, including headers,
+// chunked encoding and compressed bodies.
+type countingConn struct {
+	net.Conn
+	read    atomic.Int64
+	written atomic.Int64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.written.Add(int64(n))
+	return n, err
+}
+
+func countingDialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: DIAL_TIMEOUT, KeepAlive: DIAL_KEEP_ALIVE}
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: conn}, nil
+}
+
+func asCountingConn(conn net.Conn) *countingConn {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	counting, _ := conn.(*countingConn)
+	return counting
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"errors"
+	"fmt"
 	"net/url"
 	"strings"
 	"time"
@@ -45,7 +46,7 @@ func ValidateURL(rawURL string, selectedProtocol *Protocol) (string, error) {
 	return rawURL, nil
 }
 
-func setReqSettings(reqSettings *RequestsConfig) *RequestsConfig {
+func setReqSettings(reqSettings *RequestsConfig) (*RequestsConfig, error) {
 	if reqSettings == nil {
 		return &RequestsConfig{
 			Requests:            nil,
@@ -54,25 +55,41 @@ func setReqSettings(reqSettings *RequestsConfig) *RequestsConfig {
 			Duration:            DEFAULT_DURATION,
 			RequestChanBufSize:  DEFAULT_REQUEST_CHAN_BUF_SIZE,
 			ResponseChanBufSize: DEFAULT_RESPONSE_CHAN_BUF_SIZE,
-		}
+		}, nil
+	}
+
+	if reqSettings.Count_Workers < 0 || reqSettings.Count_Workers > MAX_COUNT_WORKERS {
+		return nil, fmt.Errorf("count of workers must be between 1 and %d, got %d", MAX_COUNT_WORKERS, reqSettings.Count_Workers)
+	}
+	if reqSettings.Delay < 0 || reqSettings.Delay > 60*time.Second {
+		return nil, fmt.Errorf("request delay must not exceed %v, got %v", 60*time.Second, reqSettings.Delay)
+	}
+	if reqSettings.Duration < 0 || reqSettings.Duration > MAX_DURATION {
+		return nil, fmt.Errorf("test duration must not exceed %v, got %v", MAX_DURATION, reqSettings.Duration)
+	}
+	if reqSettings.RequestChanBufSize < 0 || reqSettings.RequestChanBufSize > MAX_CHAN_BUF_SIZE {
+		return nil, fmt.Errorf("request channel buffer size must not exceed %d, got %d", MAX_CHAN_BUF_SIZE, reqSettings.RequestChanBufSize)
+	}
+	if reqSettings.ResponseChanBufSize < 0 || reqSettings.ResponseChanBufSize > MAX_CHAN_BUF_SIZE {
+		return nil, fmt.Errorf("response channel buffer size must not exceed %d, got %d", MAX_CHAN_BUF_SIZE, reqSettings.ResponseChanBufSize)
 	}
 
-	if reqSettings.Count_Workers == 0 || reqSettings.Count_Workers > 100 {
+	if reqSettings.Count_Workers == 0 {
 		reqSettings.Count_Workers = DEFAULT_COUNT_WORKERS
 	}
-	if reqSettings.Delay == 0 || reqSettings.Delay > 60*time.Second {
+	if reqSettings.Delay == 0 {
 		reqSettings.Delay = DEFAULT_REQ_DELAY
 	}
-	if reqSettings.Duration == 0 || reqSettings.Duration > 60*time.Minute {
+	if reqSettings.Duration == 0 {
 		reqSettings.Duration = DEFAULT_DURATION
 	}
-	if reqSettings.RequestChanBufSize == 0 || reqSettings.RequestChanBufSize > 100 {
+	if reqSettings.RequestChanBufSize == 0 {
 		reqSettings.RequestChanBufSize = DEFAULT_REQUEST_CHAN_BUF_SIZE
 	}
-	if reqSettings.ResponseChanBufSize == 0 || reqSettings.ResponseChanBufSize > 100 {
+	if reqSettings.ResponseChanBufSize == 0 {
 		reqSettings.ResponseChanBufSize = DEFAULT_RESPONSE_CHAN_BUF_SIZE
 	}
-	return reqSettings
+	return reqSettings, nil
 }
 
 func TruncateString(input string, maxLength int) string {